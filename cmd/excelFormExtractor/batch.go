@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adhadse/excelFormExtractor/pkg/extractor"
+)
+
+// workbookExtensions are the files picked up when walking a directory
+var workbookExtensions = []string{".xlsx", ".xlsm", ".xls", ".ods"}
+
+// fileResult is one NDJSON line of a batch run
+type fileResult struct {
+	File string `json:"file"`
+	extractor.Response
+	// ErrorCode tells why a workbook could not be opened or was not fully
+	// extracted, e.g. password_required for files to be handled manually
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// batchSummary is the last NDJSON line of a batch run
+type batchSummary struct {
+	Files     int `json:"files"`
+	Succeeded int `json:"succeeded"`
+	Partial   int `json:"partial"`
+	Failed    int `json:"failed"`
+	Encrypted int `json:"encrypted"` // failed because no password opened them
+}
+
+// runBatch extracts every workbook found in the given directories and globs
+// with a pool of workers, streaming one result line per file as it finishes
+// and a summary line at the end
+func runBatch(args []string) {
+	var options extractorOptions
+	flags := newFlagSet("batch", "<directory|glob>...")
+	options.register(flags)
+	workers := flags.Int("workers", runtime.NumCPU(), "number of workbooks extracted at the same time")
+	outputFile := flags.String("o", "", "write the NDJSON results to this file instead of stdout")
+	includeProvenance := flags.Bool("provenance", false, "include where every value was read from")
+	timeout := flags.Duration("timeout", 0, "time allowed for each workbook, no limit when 0")
+	sequential := flags.Bool("sequential", false, "extract the sections of a workbook one after another, for debugging")
+	positional := parseFlags(flags, args)
+
+	if len(positional) == 0 || *workers < 1 {
+		flags.Usage()
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: "batch requires at least one directory or glob and a positive worker count",
+		}, exitUsage)
+	}
+
+	// Read the template and company names once for all files
+	companyNames, template, openOptions, err := options.load()
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Failed to initialize extractor: %v", err),
+		}, exitInput)
+	}
+	requireCompanyNames(flags, companyNames, template)
+
+	files, err := findWorkbooks(positional)
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: err.Error(),
+		}, exitInput)
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		output, err = os.Create(*outputFile)
+		if err != nil {
+			printErrorAndExit(extractor.Response{
+				Status:  statusError,
+				Message: fmt.Sprintf("Failed to create %s: %v", *outputFile, err),
+			}, exitOutput)
+		}
+	}
+
+	// An interrupt cancels the workbooks being extracted and fails the
+	// remaining ones, the summary is still written
+	ctx, stop := extractionContext(0)
+	defer stop()
+
+	paths := make(chan string)
+	results := make(chan fileResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				fileCtx, cancel := withTimeout(ctx, *timeout)
+				results <- extractFile(fileCtx, path, func() (*extractor.ExcelExtractor, error) {
+					excelExtractor, err := extractor.MakeTemplateExtractorContext(fileCtx, path, companyNames, template, openOptions)
+					if err == nil {
+						excelExtractor.Sequential = *sequential
+					}
+					return excelExtractor, err
+				}, *includeProvenance)
+				cancel()
+			}
+		}()
+	}
+	go func() {
+		for _, path := range files {
+			paths <- path
+		}
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are written from this goroutine only, so lines never interleave
+	encoder := json.NewEncoder(output)
+	summary := batchSummary{Files: len(files)}
+	writeFailed := false
+	for result := range results {
+		switch result.Status {
+		case statusSuccess:
+			summary.Succeeded++
+		case statusPartial:
+			summary.Partial++
+		default:
+			summary.Failed++
+			if result.ErrorCode == errorCodePasswordRequired || result.ErrorCode == errorCodeWrongPassword {
+				summary.Encrypted++
+			}
+		}
+		if err := encoder.Encode(result); err != nil {
+			writeFailed = true
+		}
+	}
+
+	status, code := statusSuccess, exitSuccess
+	if summary.Partial > 0 || summary.Failed > 0 {
+		status, code = statusPartial, exitPartial
+	}
+	err = encoder.Encode(extractor.Response{
+		Status:  status,
+		Message: fmt.Sprintf("Processed %d file(s): %d succeeded, %d partial, %d failed (%d encrypted)", summary.Files, summary.Succeeded, summary.Partial, summary.Failed, summary.Encrypted),
+		Data:    summary,
+	})
+	if output != os.Stdout && output.Close() != nil {
+		writeFailed = true
+	}
+	if err != nil || writeFailed {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: "Failed to write results",
+		}, exitOutput)
+	}
+	os.Exit(code)
+}
+
+// extractFile extracts one workbook with its own extractor, created by open
+// and always closed before returning. An extraction stopped by ctx is partial.
+func extractFile(ctx context.Context, name string, open func() (*extractor.ExcelExtractor, error), includeProvenance bool) (result fileResult) {
+	result.File = name
+	defer func() {
+		if r := recover(); r != nil {
+			result.Response = extractor.Response{
+				Status:  statusError,
+				Message: fmt.Sprintf("panic extracting workbook: %v", r),
+			}
+		}
+	}()
+
+	excelExtractor, err := open()
+	if err != nil {
+		result.Response = extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Failed to initialize extractor: %v", err),
+		}
+		result.ErrorCode = errorCode(err)
+		return result
+	}
+	defer excelExtractor.Close()
+
+	extraction, err := excelExtractor.ExtractContext(ctx)
+	if !includeProvenance {
+		extraction.Provenance = nil
+	}
+	if err != nil {
+		result.Response = extractor.Response{
+			Status:  statusPartial,
+			Message: err.Error(),
+			Data:    extraction,
+		}
+		// canceled, timed out or over a limit
+		if code := errorCode(err); code != errorCodeOpenFailed {
+			result.ErrorCode = code
+		}
+		return result
+	}
+	result.Response = extractor.Response{
+		Status:  statusSuccess,
+		Message: "Extraction completed",
+		Data:    extraction,
+	}
+	return result
+}
+
+// findWorkbooks expands directories (recursively) and globs into a sorted
+// list of workbook files. Excel lock files (~$name.xlsx) are skipped.
+func findWorkbooks(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if !isLockFile(filepath.Base(match)) {
+					add(match)
+				}
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !entry.IsDir() && isWorkbook(entry.Name()) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", match, err)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func isWorkbook(name string) bool {
+	if isLockFile(name) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, workbookExt := range workbookExtensions {
+		if ext == workbookExt {
+			return true
+		}
+	}
+	return false
+}
+
+// isLockFile reports whether name is the lock file Excel keeps next to an
+// open workbook
+func isLockFile(name string) bool {
+	return strings.HasPrefix(name, "~$")
+}
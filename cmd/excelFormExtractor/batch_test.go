@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindWorkbooks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.xlsx", "sub/b.XLSM", "sub/deeper/c.xlsx", "~$a.xlsx", "notes.txt", "other/d.xlsx"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		paths := make([]string, len(names))
+		for i, name := range names {
+			paths[i] = filepath.Join(dir, name)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "directory walked recursively",
+			patterns: join("sub"),
+			want:     join("sub/b.XLSM", "sub/deeper/c.xlsx"),
+		},
+		{
+			name:     "lock files and other files skipped",
+			patterns: []string{dir},
+			want:     join("a.xlsx", "other/d.xlsx", "sub/b.XLSM", "sub/deeper/c.xlsx"),
+		},
+		{
+			name:     "glob",
+			patterns: join("*/*.xlsx"),
+			want:     join("other/d.xlsx"),
+		},
+		{
+			name:     "file named by a glob and a directory listed once",
+			patterns: append(join("a.xlsx"), dir+"/*.xlsx", dir),
+			want:     join("a.xlsx", "other/d.xlsx", "sub/b.XLSM", "sub/deeper/c.xlsx"),
+		},
+		{
+			name:     "glob matching nothing",
+			patterns: join("*.xls"),
+			wantErr:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := findWorkbooks(test.patterns)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// batchLine holds the fields of an NDJSON line of a batch run
+type batchLine struct {
+	File    string          `json:"file"`
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// parseBatchOutput splits NDJSON batch output into the file results, by file
+// name, and the summary line
+func parseBatchOutput(t *testing.T, output string) (map[string]batchLine, batchLine, batchSummary) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	results := map[string]batchLine{}
+	var summary batchLine
+	for i, line := range lines {
+		var parsed batchLine
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			t.Fatalf("line %d is not JSON: %v: %s", i+1, err, line)
+		}
+		if i == len(lines)-1 {
+			summary = parsed
+			continue
+		}
+		if parsed.File == "" {
+			t.Errorf("line %d has no file: %s", i+1, line)
+		}
+		results[filepath.Base(parsed.File)] = parsed
+	}
+
+	var counts batchSummary
+	if err := json.Unmarshal(summary.Data, &counts); err != nil {
+		t.Fatalf("summary line has no counts: %v", err)
+	}
+	return results, summary, counts
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	writeWorkbook(t, filepath.Join(dir, "forms", "first.xlsx"), "PN-1")
+	writeWorkbook(t, filepath.Join(dir, "forms", "2024", "second.xlsx"), "PN-2")
+
+	t.Run("all files extracted", func(t *testing.T) {
+		output, code := runCommand(t, nil, "batch", "-company", "Amazon", "-workers", "2", filepath.Join(dir, "forms"))
+		if code != exitSuccess {
+			t.Fatalf("got exit code %d, want %d", code, exitSuccess)
+		}
+
+		results, summary, counts := parseBatchOutput(t, output)
+		if summary.Status != statusSuccess || counts != (batchSummary{Files: 2, Succeeded: 2}) {
+			t.Errorf("got summary %s %+v, want success for 2 files", summary.Status, counts)
+		}
+		for name, partNumber := range map[string]string{"first.xlsx": "PN-1", "second.xlsx": "PN-2"} {
+			result, ok := results[name]
+			if !ok {
+				t.Errorf("no result for %s", name)
+				continue
+			}
+			var data struct {
+				BuyerDetails struct {
+					PartNumber string `json:"part_number"`
+				} `json:"buyer_details"`
+			}
+			if err := json.Unmarshal(result.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != statusSuccess || data.BuyerDetails.PartNumber != partNumber {
+				t.Errorf("%s: got %s with part number %q, want success with %q", name, result.Status, data.BuyerDetails.PartNumber, partNumber)
+			}
+		}
+	})
+
+	t.Run("failed file", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken", "broken.xlsx")
+		if err := os.MkdirAll(filepath.Dir(broken), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(broken, []byte("not a workbook"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		outputFile := filepath.Join(dir, "results.ndjson")
+
+		stdout, code := runCommand(t, nil, "batch", "-company", "Amazon", "-o", outputFile, filepath.Join(dir, "forms"), filepath.Join(dir, "broken", "*.xlsx"))
+		if code != exitPartial {
+			t.Errorf("got exit code %d, want %d", code, exitPartial)
+		}
+		if stdout != "" {
+			t.Errorf("got %q on stdout, want the results in the output file only", stdout)
+		}
+
+		output, err := os.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, summary, counts := parseBatchOutput(t, string(output))
+		if summary.Status != statusPartial || counts != (batchSummary{Files: 3, Succeeded: 2, Failed: 1}) {
+			t.Errorf("got summary %s %+v, want partial with 1 of 3 files failed", summary.Status, counts)
+		}
+		if result := results["broken.xlsx"]; result.Status != statusError || result.Message == "" {
+			t.Errorf("got %+v for the broken file, want an error with a message", result)
+		}
+		if results["first.xlsx"].Status != statusSuccess {
+			t.Errorf("got %s for first.xlsx, want the other files still extracted", results["first.xlsx"].Status)
+		}
+	})
+
+	t.Run("no arguments", func(t *testing.T) {
+		if _, code := runCommand(t, nil, "batch", "-company", "Amazon"); code != exitUsage {
+			t.Errorf("got exit code %d, want %d", code, exitUsage)
+		}
+	})
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adhadse/excelFormExtractor/pkg/extractor"
+	"gopkg.in/yaml.v3"
+)
+
+// stdinPath is the workbook argument reading the workbook from stdin
+const stdinPath = "-"
+
+// stringList is a flag that may be repeated or given as a comma separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// configFile is the file given with -companies or -passwords, in YAML or
+// JSON:
+//
+//	company_names: ["Amazon", "Amazon Inc"]
+//	passwords: ["supplier-secret"]
+type configFile struct {
+	CompanyNames []string `yaml:"company_names" json:"company_names"`
+	Passwords    []string `yaml:"passwords" json:"passwords"`
+}
+
+func readConfigFile(path string) (configFile, error) {
+	var config configFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// extractorOptions are the flags selecting the company names, template,
+// workbook passwords and limits
+type extractorOptions struct {
+	companies     stringList
+	companiesFile string
+	templatePath  string
+	passwords     stringList
+	passwordsFile string
+	maxFileMB     int64
+	limits        limitOptions
+}
+
+func (o *extractorOptions) register(flags *flag.FlagSet) {
+	flags.Var(&o.companies, "company", "company name mentioned in the form, repeatable or comma separated")
+	flags.StringVar(&o.companiesFile, "companies", "", "YAML or JSON file with a company_names list")
+	flags.StringVar(&o.templatePath, "template", "", "template file, the built-in SECCF template when empty")
+	flags.Var(&o.passwords, "password", "password tried on encrypted workbooks, repeatable")
+	flags.StringVar(&o.passwordsFile, "passwords", "", "YAML or JSON file with a passwords list tried on encrypted workbooks")
+	flags.Int64Var(&o.maxFileMB, "max-file-mb", extractor.DefaultLimits().MaxFileSize>>20, "largest workbook file in MiB, no limit when 0")
+	o.limits.register(flags)
+}
+
+// limitOptions are the flags bounding what is read from a workbook, 0
+// disables a limit
+type limitOptions struct {
+	maxUnzipMB  int64
+	maxSheets   int
+	maxRows     int
+	maxPictures int
+	maxCells    int
+}
+
+func (o *limitOptions) register(flags *flag.FlagSet) {
+	defaults := extractor.DefaultLimits()
+	flags.Int64Var(&o.maxUnzipMB, "max-unzip-mb", defaults.UnzipSizeLimit>>20, "largest unzipped workbook in MiB, no limit when 0")
+	flags.IntVar(&o.maxSheets, "max-sheets", defaults.MaxSheets, "most sheets in a workbook, no limit when 0")
+	flags.IntVar(&o.maxRows, "max-rows", defaults.MaxRows, "most rows read from a sheet, no limit when 0")
+	flags.IntVar(&o.maxPictures, "max-pictures", defaults.MaxPictures, "most pictures in a workbook, no limit when 0")
+	flags.IntVar(&o.maxCells, "max-cells", defaults.MaxCells, "most non-empty cells in a .xls or .ods workbook, no limit when 0")
+}
+
+// limits returns the limits of the flags, reading workbook files of up to
+// maxFileSize bytes
+func (o *limitOptions) limits(maxFileSize int64) extractor.Limits {
+	limits := extractor.DefaultLimits()
+	limits.MaxFileSize = maxFileSize
+	limits.UnzipSizeLimit = o.maxUnzipMB << 20
+	limits.MaxSheets = o.maxSheets
+	limits.MaxRows = o.maxRows
+	limits.MaxPictures = o.maxPictures
+	limits.MaxCells = o.maxCells
+	// excelize refuses an XML limit above the unzip one
+	if limits.UnzipSizeLimit > 0 && limits.UnzipXMLSizeLimit > limits.UnzipSizeLimit {
+		limits.UnzipXMLSizeLimit = limits.UnzipSizeLimit
+	}
+	return limits
+}
+
+// companyNames returns the names given with -company followed by the ones
+// of the -companies file
+func (o *extractorOptions) companyNames() (extractor.CompanyNameList, error) {
+	names := extractor.CompanyNameList(o.companies)
+	if o.companiesFile == "" {
+		return names, nil
+	}
+
+	config, err := readConfigFile(o.companiesFile)
+	if err != nil {
+		return nil, err
+	}
+	return append(names, config.CompanyNames...), nil
+}
+
+// openOptions returns the passwords given with -password followed by the
+// ones of the -passwords file, and the limits
+func (o *extractorOptions) openOptions() (*extractor.OpenOptions, error) {
+	options := &extractor.OpenOptions{Passwords: o.passwords, Limits: o.limits.limits(o.maxFileMB << 20)}
+	if o.passwordsFile == "" {
+		return options, nil
+	}
+
+	config, err := readConfigFile(o.passwordsFile)
+	if err != nil {
+		return nil, err
+	}
+	options.Passwords = append(options.Passwords, config.Passwords...)
+	return options, nil
+}
+
+func (o *extractorOptions) template() (*extractor.FormTemplate, error) {
+	if o.templatePath == "" {
+		return extractor.DefaultSECCFTemplate(), nil
+	}
+	return extractor.LoadTemplate(o.templatePath)
+}
+
+// load reads the company names, the template and the passwords
+func (o *extractorOptions) load() (extractor.CompanyNameList, *extractor.FormTemplate, *extractor.OpenOptions, error) {
+	companyNames, err := o.companyNames()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	template, err := o.template()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	openOptions, err := o.openOptions()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return companyNames, template, openOptions, nil
+}
+
+// open creates the extractor for one workbook, read from stdin when the
+// path is "-"
+func (o *extractorOptions) open(ctx context.Context, path string) (*extractor.ExcelExtractor, error) {
+	companyNames, template, openOptions, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+	return openWorkbook(ctx, path, companyNames, template, openOptions)
+}
+
+// openWorkbook creates the extractor for one workbook with the loaded
+// options, reading it from stdin when the path is "-"
+func openWorkbook(ctx context.Context, path string, companyNames extractor.CompanyNameList, template *extractor.FormTemplate, openOptions *extractor.OpenOptions) (*extractor.ExcelExtractor, error) {
+	if path == stdinPath {
+		// read no more than the file size limit
+		return extractor.MakeTemplateExtractorFromReaderContext(ctx, os.Stdin, companyNames, template, openOptions)
+	}
+	return extractor.MakeTemplateExtractorContext(ctx, path, companyNames, template, openOptions)
+}
+
+// extractionContext is canceled on interrupt and, when timeout is set, once
+// it has passed
+func extractionContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := withTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// withTimeout is context.WithTimeout, without a deadline when timeout is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Reasons a workbook could not be opened or extracted, reported as
+// error_code
+const (
+	errorCodePasswordRequired = "password_required"
+	errorCodeWrongPassword    = "wrong_password"
+	errorCodeOpenFailed       = "open_failed"
+	errorCodeLimitExceeded    = "limit_exceeded" // the workbook is too large
+	errorCodeTimeout          = "timeout"        // the deadline passed
+	errorCodeCanceled         = "canceled"       // interrupted
+)
+
+// errorCode classifies the error of opening or extracting a workbook, so
+// encrypted or oversized workbooks can be told apart from broken ones
+func errorCode(err error) string {
+	var passwordRequired extractor.PasswordRequiredError
+	var wrongPassword extractor.WrongPasswordError
+	var canceled extractor.CanceledError
+	var limitExceeded extractor.LimitExceededError
+	switch {
+	case errors.As(err, &passwordRequired):
+		return errorCodePasswordRequired
+	case errors.As(err, &wrongPassword):
+		return errorCodeWrongPassword
+	case errors.As(err, &canceled):
+		return canceledErrorCode(err)
+	case errors.As(err, &limitExceeded):
+		return errorCodeLimitExceeded
+	default:
+		return errorCodeOpenFailed
+	}
+}
+
+// canceledErrorCode tells a timeout from an interruption
+func canceledErrorCode(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorCodeTimeout
+	}
+	return errorCodeCanceled
+}
+
+// exitInitError reports a workbook that could not be opened, with
+// exitEncrypted for password problems
+func exitInitError(err error) {
+	code := exitInput
+	if reason := errorCode(err); reason == errorCodePasswordRequired || reason == errorCodeWrongPassword {
+		code = exitEncrypted
+	}
+	printErrorAndExit(extractor.Response{
+		Status:  statusError,
+		Message: fmt.Sprintf("Failed to initialize extractor: %v", err),
+	}, code)
+}
+
+// parseFlags parses the flags of a command, which may come before or after
+// its arguments, and returns the arguments
+func parseFlags(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(exitSuccess)
+			}
+			printErrorAndExit(extractor.Response{
+				Status:  statusError,
+				Message: err.Error(),
+			}, exitUsage)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func newFlagSet(name string, arguments string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: excelFormExtractor %s [flags] %s\n\nFlags:\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// requireWorkbook returns the single workbook argument of a command
+func requireWorkbook(flags *flag.FlagSet, positional []string) string {
+	if len(positional) != 1 {
+		flags.Usage()
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("%s requires exactly one workbook path", flags.Name()),
+		}, exitUsage)
+	}
+	return positional[0]
+}
+
+// requireCompanyNames fails with a usage error when the template searches
+// for {companyName} and no company names were given
+func requireCompanyNames(flags *flag.FlagSet, companyNames extractor.CompanyNameList, template *extractor.FormTemplate) {
+	if len(companyNames) == 0 && template.UsesCompanyNames() {
+		flags.Usage()
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("template %s searches for {companyName}, give company names with -company or -companies", template.Name),
+		}, exitUsage)
+	}
+}
+
+func checkOutput(output *outputOptions) {
+	if err := output.validate(); err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: err.Error(),
+		}, exitUsage)
+	}
+}
+
+// runExtract extracts one workbook. Extraction errors still print the
+// partial result, with status "partial" and exit code exitPartial.
+func runExtract(args []string) {
+	var options extractorOptions
+	var output outputOptions
+	flags := newFlagSet("extract", "<workbook.xlsx|->")
+	options.register(flags)
+	output.register(flags)
+	includeProvenance := flags.Bool("provenance", false, "include where every value was read from")
+	timeout := flags.Duration("timeout", 0, "time allowed for the extraction, no limit when 0")
+	sequential := flags.Bool("sequential", false, "extract the sections one after another, for debugging")
+	path := requireWorkbook(flags, parseFlags(flags, args))
+	checkOutput(&output)
+
+	companyNames, template, openOptions, err := options.load()
+	if err != nil {
+		exitInitError(err)
+	}
+	requireCompanyNames(flags, companyNames, template)
+
+	ctx, cancel := extractionContext(*timeout)
+	defer cancel()
+
+	excelExtractor, err := openWorkbook(ctx, path, companyNames, template, openOptions)
+	if err != nil {
+		exitInitError(err)
+	}
+	excelExtractor.IncludeProvenance = *includeProvenance
+	excelExtractor.Sequential = *sequential
+
+	// a canceled extraction prints what was extracted until then
+	extraction, err := excelExtractor.ExtractContext(ctx)
+	excelExtractor.Close()
+	if !*includeProvenance {
+		extraction.Provenance = nil
+	}
+
+	if err != nil {
+		output.writeAndExit(extractor.Response{
+			Status:  statusPartial,
+			Message: err.Error(),
+			Data:    extraction,
+		}, exitPartial)
+	}
+	output.writeAndExit(extractor.Response{
+		Status:  statusSuccess,
+		Message: "Extraction completed",
+		Data:    extraction,
+	}, exitSuccess)
+}
+
+// runInspect prints the structure of one workbook
+func runInspect(args []string) {
+	var options extractorOptions
+	var output outputOptions
+	flags := newFlagSet("inspect", "<workbook.xlsx|->")
+	options.register(flags)
+	output.register(flags)
+	path := requireWorkbook(flags, parseFlags(flags, args))
+	checkOutput(&output)
+
+	excelExtractor, err := options.open(context.Background(), path)
+	if err != nil {
+		exitInitError(err)
+	}
+	info, err := excelExtractor.Inspect()
+	excelExtractor.Close()
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Failed to inspect workbook: %v", err),
+		}, exitInput)
+	}
+
+	output.writeAndExit(extractor.Response{
+		Status:  statusSuccess,
+		Message: fmt.Sprintf("Workbook has %d sheet(s)", len(info.Sheets)),
+		Data:    info,
+	}, exitSuccess)
+}
+
+// runValidate checks a template file and prints it as parsed
+func runValidate(args []string) {
+	var output outputOptions
+	flags := newFlagSet("validate", "[template.yaml]")
+	templatePath := flags.String("template", "", "template file, the built-in SECCF template when empty")
+	output.register(flags)
+	positional := parseFlags(flags, args)
+	checkOutput(&output)
+
+	if len(positional) > 1 || (len(positional) == 1 && *templatePath != "") {
+		flags.Usage()
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: "validate takes at most one template",
+		}, exitUsage)
+	}
+	if len(positional) == 1 {
+		*templatePath = positional[0]
+	}
+
+	options := extractorOptions{templatePath: *templatePath}
+	template, err := options.template()
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Invalid template: %v", err),
+		}, exitInput)
+	}
+
+	output.writeAndExit(extractor.Response{
+		Status:  statusSuccess,
+		Message: fmt.Sprintf("Template %s is valid", template.Name),
+		Data:    template,
+	}, exitSuccess)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// encryptWorkbook encrypts the workbook at path with password
+func encryptWorkbook(t *testing.T, path string, password string) {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.SaveAs(path, excelize.Options{Password: password}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "encrypted.xlsx")
+	writeWorkbook(t, path, "PN-1")
+	encryptWorkbook(t, path, "secret")
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "no password", wantCode: exitEncrypted},
+		{name: "wrong password", args: []string{"-password", "guess"}, wantCode: exitEncrypted},
+		{name: "second candidate", args: []string{"-password", "guess,secret"}, wantCode: exitSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"extract", "-company", "Amazon"}, test.args...)
+			output, code := runCommand(t, nil, append(args, path)...)
+			if code != test.wantCode {
+				t.Fatalf("got exit code %d, want %d", code, test.wantCode)
+			}
+			if test.wantCode != exitSuccess {
+				return
+			}
+
+			var response struct {
+				Data struct {
+					BuyerDetails struct {
+						PartNumber string `json:"part_number"`
+					} `json:"buyer_details"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(output), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Data.BuyerDetails.PartNumber != "PN-1" {
+				t.Errorf("got part number %q, want PN-1", response.Data.BuyerDetails.PartNumber)
+			}
+		})
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workbook.xlsx")
+	writeWorkbook(t, path, "PN-1")
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantCode    int
+		wantMessage string // start of the message of a partial result
+	}{
+		{name: "within the limits", wantCode: exitSuccess},
+		{name: "sheets", args: []string{"-max-sheets", "2"}, wantCode: exitInput},
+		{name: "limits disabled", args: []string{"-max-sheets", "0", "-max-rows", "0", "-max-unzip-mb", "0"}, wantCode: exitSuccess},
+		{name: "rows", args: []string{"-max-rows", "3"}, wantCode: exitPartial, wantMessage: "sheet Buyer Details exceeds the rows limit of 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := append([]string{"extract", "-company", "Amazon"}, test.args...)
+			output, code := runCommand(t, nil, append(args, path)...)
+			if code != test.wantCode {
+				t.Fatalf("got exit code %d, want %d", code, test.wantCode)
+			}
+			if test.wantMessage == "" {
+				return
+			}
+
+			var response struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal([]byte(output), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(response.Message, test.wantMessage) {
+				t.Errorf("got message %q, want %q", response.Message, test.wantMessage)
+			}
+		})
+	}
+}
+
+// padWorkbook adds a sheet of random text to the workbook at path, making
+// it larger than size once compressed
+func padWorkbook(t *testing.T, path string, size int) {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.NewSheet("Notes"); err != nil {
+		t.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(1))
+	noise := make([]byte, 24000)
+	for row := 1; row*len(noise) <= size; row++ {
+		random.Read(noise)
+		if err := f.SetCellStr("Notes", fmt.Sprintf("A%d", row), base64.StdEncoding.EncodeToString(noise)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractFileSizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workbook.xlsx")
+	writeWorkbook(t, path, "PN-1")
+	padWorkbook(t, path, 2<<20)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		maxMB    string
+		stdin    bool
+		wantCode int
+	}{
+		{name: "file within the limit", maxMB: "4", wantCode: exitSuccess},
+		{name: "file over the limit", maxMB: "1", wantCode: exitInput},
+		{name: "stdin within the limit", maxMB: "4", stdin: true, wantCode: exitSuccess},
+		{name: "stdin over the limit", maxMB: "1", stdin: true, wantCode: exitInput},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := []string{"extract", "-company", "Amazon", "-max-file-mb", test.maxMB, path}
+			var stdin io.Reader
+			if test.stdin {
+				args[len(args)-1], stdin = stdinPath, bytes.NewReader(data)
+			}
+			if _, code := runCommand(t, stdin, args...); code != test.wantCode {
+				t.Errorf("got exit code %d, want %d", code, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestExtractWithoutCompanyNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "workbook.xlsx")
+	writeWorkbook(t, path, "PN-1")
+	// a template without {companyName} needs no company names
+	templatePath := filepath.Join(dir, "plain.yaml")
+	template := `name: plain
+sections:
+  - name: buyer_details
+    sheet: buyer details
+    fields:
+      PartNumber:
+        search_terms: ["part number"]
+        cell_ranges:
+          - {start_cell: B12, end_cell: D12}
+        offset: 3
+`
+	if err := os.WriteFile(templatePath, []byte(template), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "extract", args: []string{"extract", path}, wantCode: exitUsage},
+		{name: "batch", args: []string{"batch", dir}, wantCode: exitUsage},
+		{name: "template without the placeholder", args: []string{"extract", "-template", templatePath, path}, wantCode: exitSuccess},
+		{name: "inspect", args: []string{"inspect", path}, wantCode: exitSuccess},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, code := runCommand(t, nil, test.args...); code != test.wantCode {
+				t.Errorf("got exit code %d, want %d", code, test.wantCode)
+			}
+		})
+	}
+}
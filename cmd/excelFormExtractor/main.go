@@ -1,118 +1,80 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"strings"
 
 	"github.com/adhadse/excelFormExtractor/pkg/extractor"
 )
 
-func printSuccessAndExit(response extractor.Response) {
-	jsonResponse, _ := json.Marshal(response)
-	fmt.Println(string(jsonResponse))
-	os.Exit(0)
-}
+// Exit codes
+const (
+	exitSuccess   = 0 // command completed
+	exitUsage     = 1 // unknown command, bad flags or missing arguments
+	exitInput     = 2 // workbook, template or company file could not be read
+	exitPartial   = 3 // extraction finished with errors, the partial result is printed
+	exitOutput    = 4 // result could not be written
+	exitEncrypted = 5 // workbook is encrypted and no given password opens it
+)
 
-func printErrorAndExit(response extractor.Response, code int) {
-	jsonResponse, _ := json.Marshal(response)
-	fmt.Fprintln(os.Stderr, string(jsonResponse))
-	os.Exit(code)
+const usage = `Usage: excelFormExtractor <command> [flags] [arguments]
+
+Commands:
+  extract   extract a workbook into JSON
+  batch     extract every workbook of directories or globs into NDJSON
+  inspect   list the sheets, merged ranges and form controls of a workbook
+  validate  check a template file, the built-in SECCF template when none is given
+  serve     extract uploaded workbooks over HTTP
+  help      show this help
+
+Run "excelFormExtractor <command> -h" for the flags of a command.
+
+Exit codes:
+  0  success
+  1  usage error
+  2  workbook, template or company file could not be read
+  3  extraction finished with errors, the partial result is printed
+     (batch: at least one file was partial or failed)
+  4  result could not be written
+  5  workbook is encrypted and no given password opens it
+`
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, usage)
 }
 
 func main() {
-	// extractor.ReadFormControls()
-
 	// Check if arguments are provided
 	if len(os.Args) < 2 {
-		// Return error for missing arguments
-		response := extractor.Response{
-			Status:  "error",
-			Message: "No arguments provided",
-		}
-		printErrorAndExit(response, 1)
+		printUsage(os.Stderr)
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: "No command provided",
+		}, exitUsage)
 	}
 
-	// Get the command from first argument
 	command := os.Args[1]
+	args := os.Args[2:]
 
-	// Example command handling
 	switch command {
-	case "hello":
-		// Success case
-		response := extractor.Response{
-			Status:  "success",
-			Message: "Hello command executed successfully",
-			Data:    "Hello, World!",
-		}
-		printSuccessAndExit(response)
-
-	case "seccf":
-		// Check for required second argument
-		if len(os.Args) < 3 {
-			response := extractor.Response{
-				Status:  "error",
-				Message: "SCEEF excel requires path name parameter",
-			}
-			printErrorAndExit(response, 2)
-		}
-
-		input := os.Args[2]
-
-		seccf_extr, err := extractor.MakeSECCFExtractor(input, []string{"Amazon", "Amazon Inc", "Aamazon Ltd"})
-		if err != nil {
-			fmt.Printf("Failed to initialize extractor: %v\n", err)
-			return
-		}
-		defer seccf_extr.Close()
-
-		seccf_extr.Extract()
-		// seccf_extr.ReadFormControls()
-
-		// response := Response{
-		// 	Status:  "success",
-		// 	Message: "Processing completed",
-		// 	Data:    map[string]string{"processed": strings.ToUpper(input)},
-		// }
-		// printSuccessAndExit(response)
-
-	case "process":
-		// Check for required second argument
-		if len(os.Args) < 3 {
-			response := extractor.Response{
-				Status:  "error",
-				Message: "Process command requires a parameter",
-			}
-			printErrorAndExit(response, 2)
-		}
-
-		// Process the input
-		input := os.Args[2]
-		if strings.ToLower(input) == "fail" {
-			// Simulate a process failure
-			response := extractor.Response{
-				Status:  "error",
-				Message: "Process failed as requested",
-				Data:    map[string]string{"failed_input": input},
-			}
-			printErrorAndExit(response, 3)
-		}
-
-		// Success case with processed data
-		response := extractor.Response{
-			Status:  "success",
-			Message: "Processing completed",
-			Data:    map[string]string{"processed": strings.ToUpper(input)},
-		}
-		printSuccessAndExit(response)
-
+	case "extract":
+		runExtract(args)
+	case "batch":
+		runBatch(args)
+	case "inspect":
+		runInspect(args)
+	case "validate":
+		runValidate(args)
+	case "serve":
+		runServe(args)
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
 	default:
-		// Unknown command error
-		response := extractor.Response{
-			Status:  "error",
+		printUsage(os.Stderr)
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
 			Message: fmt.Sprintf("Unknown command: %s", command),
-		}
-		printErrorAndExit(response, 4)
+		}, exitUsage)
 	}
 }
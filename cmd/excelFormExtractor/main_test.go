@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so the
+// commands can be run with their exit codes, see runCommand
+const runMainEnv = "EXCELFORMEXTRACTOR_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(exitSuccess)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command line tool with args and stdin, returning what
+// it wrote to stdout and its exit code
+func runCommand(t *testing.T, stdin io.Reader, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	if stderr.Len() > 0 {
+		t.Logf("stderr: %s", stderr.String())
+	}
+	return stdout.String(), cmd.ProcessState.ExitCode()
+}
+
+// writeWorkbook saves a workbook with the sheets of the built-in SECCF
+// template to path, the part number next to its label
+func writeWorkbook(t *testing.T, path string, partNumber string) {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheets := map[string]map[string]string{
+		"Buyer Details":      {"B12": "Part Number", "E12": partNumber},
+		"Product Details":    {"C11": "Supplier part number", "E11": "S-1"},
+		"Controlled Content": {"A3": "Item", "B3": "Part Number", "A4": "1", "B4": partNumber},
+	}
+	for _, sheetName := range []string{"Buyer Details", "Product Details", "Controlled Content"} {
+		if _, err := f.NewSheet(sheetName); err != nil {
+			t.Fatal(err)
+		}
+		for cell, value := range sheets[sheetName] {
+			if err := f.SetCellStr(sheetName, cell, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+}
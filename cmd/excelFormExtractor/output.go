@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adhadse/excelFormExtractor/pkg/extractor"
+)
+
+// Response statuses
+const (
+	statusSuccess = "success"
+	statusPartial = "partial" // extraction finished with errors
+	statusError   = "error"
+)
+
+// Output formats
+const (
+	formatJSON   = "json"   // one line
+	formatPretty = "pretty" // indented
+)
+
+// outputOptions are the flags controlling where and how a result is written
+type outputOptions struct {
+	format     string
+	outputFile string
+}
+
+func (o *outputOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.format, "format", formatJSON, "output format: json or pretty")
+	flags.StringVar(&o.outputFile, "o", "", "write the result to this file instead of stdout")
+}
+
+func (o *outputOptions) validate() error {
+	if o.format != formatJSON && o.format != formatPretty {
+		return fmt.Errorf("unknown output format: %s", o.format)
+	}
+	return nil
+}
+
+func (o *outputOptions) marshal(response extractor.Response) ([]byte, error) {
+	if o.format == formatPretty {
+		return json.MarshalIndent(response, "", "  ")
+	}
+	return json.Marshal(response)
+}
+
+// writeAndExit writes the response to the output file or stdout and exits
+// with the given code
+func (o *outputOptions) writeAndExit(response extractor.Response, code int) {
+	jsonResponse, err := o.marshal(response)
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Failed to encode result: %v", err),
+		}, exitOutput)
+	}
+	jsonResponse = append(jsonResponse, '\n')
+
+	if o.outputFile == "" {
+		os.Stdout.Write(jsonResponse)
+		os.Exit(code)
+	}
+
+	if err := os.WriteFile(o.outputFile, jsonResponse, 0o644); err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: fmt.Sprintf("Failed to write %s: %v", o.outputFile, err),
+		}, exitOutput)
+	}
+	os.Exit(code)
+}
+
+func printErrorAndExit(response extractor.Response, code int) {
+	jsonResponse, _ := json.Marshal(response)
+	fmt.Fprintln(os.Stderr, string(jsonResponse))
+	os.Exit(code)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adhadse/excelFormExtractor/pkg/extractor"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// builtInTemplate is the name the built-in SECCF template is served under
+const builtInTemplate = "seccf"
+
+// server extracts uploaded workbooks over HTTP
+type server struct {
+	companyNames   extractor.CompanyNameList // used when a request names none
+	templates      map[string]*extractor.FormTemplate
+	maxUploadBytes int64
+	limits         extractor.Limits // MaxFileSize is maxUploadBytes
+	timeout        time.Duration
+	// slots holds a token per extraction in progress, nil for no limit
+	slots chan struct{}
+	// open opens an upload, MakeTemplateExtractorFromBytesContext outside tests
+	open func(ctx context.Context, data []byte, companyNames extractor.CompanyNameList, template *extractor.FormTemplate, options *extractor.OpenOptions) (*extractor.ExcelExtractor, error)
+}
+
+// runServe starts the HTTP API and serves until interrupted
+func runServe(args []string) {
+	var options extractorOptions
+	flags := newFlagSet("serve", "")
+	flags.Var(&options.companies, "company", "default company name when a request names none, repeatable or comma separated")
+	flags.StringVar(&options.companiesFile, "companies", "", "YAML or JSON file with the default company_names list")
+	addr := flags.String("addr", ":8080", "address to listen on")
+	templatesDir := flags.String("templates", "", "directory of template files, served by file name without extension")
+	maxUploadMB := flags.Int64("max-upload-mb", 32, "largest accepted upload in MiB")
+	timeout := flags.Duration("timeout", time.Minute, "time allowed for one extraction")
+	maxConcurrent := flags.Int("max-concurrent", runtime.NumCPU(), "extractions run at the same time, further uploads are answered with 503; no limit when 0")
+	options.limits.register(flags)
+	if positional := parseFlags(flags, args); len(positional) > 0 || *maxUploadMB < 1 || *timeout <= 0 || *maxConcurrent < 0 {
+		flags.Usage()
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: "serve takes no arguments and needs a positive upload limit and timeout",
+		}, exitUsage)
+	}
+
+	companyNames, err := options.companyNames()
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: err.Error(),
+		}, exitInput)
+	}
+	templates, err := loadTemplates(*templatesDir)
+	if err != nil {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: err.Error(),
+		}, exitInput)
+	}
+
+	s := &server{
+		companyNames:   companyNames,
+		templates:      templates,
+		maxUploadBytes: *maxUploadMB << 20,
+		limits:         options.limits.limits(*maxUploadMB << 20),
+		timeout:        *timeout,
+		open:           extractor.MakeTemplateExtractorFromBytesContext,
+	}
+	if *maxConcurrent > 0 {
+		s.slots = make(chan struct{}, *maxConcurrent)
+	}
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      *timeout + 30*time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		printErrorAndExit(extractor.Response{
+			Status:  statusError,
+			Message: err.Error(),
+		}, exitInput)
+	}
+}
+
+// loadTemplates reads every template of dir, keyed by file name without
+// extension, next to the built-in SECCF template
+func loadTemplates(dir string) (map[string]*extractor.FormTemplate, error) {
+	templates := map[string]*extractor.FormTemplate{builtInTemplate: extractor.DefaultSECCFTemplate()}
+	if dir == "" {
+		return templates, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		template, err := extractor.LoadTemplate(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", entry.Name(), err)
+		}
+		templates[strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))] = template
+	}
+	return templates, nil
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/version", s.handleVersion)
+	mux.HandleFunc("/extract", s.handleExtract)
+	return mux
+}
+
+func writeResponse(w http.ResponseWriter, code int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeResponse(w, code, extractor.Response{
+		Status:  statusError,
+		Message: message,
+	})
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, extractor.Response{
+		Status:  statusSuccess,
+		Message: "ok",
+	})
+}
+
+func (s *server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	v := version
+	if v == "" {
+		v = "devel"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+
+	templates := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	writeResponse(w, http.StatusOK, extractor.Response{
+		Status:  statusSuccess,
+		Message: "excelFormExtractor " + v,
+		Data: map[string]any{
+			"version":    v,
+			"go_version": runtime.Version(),
+			"templates":  templates,
+		},
+	})
+}
+
+// timeoutGrace is how long a timed out request waits for the extraction to
+// return its partial result
+const timeoutGrace = 2 * time.Second
+
+// extractResponse is the answer to an upload: the response of extract and the
+// error code of a workbook that was not opened or not fully extracted
+type extractResponse struct {
+	extractor.Response
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// passwordHeader carries a password of a raw upload, repeatable
+const passwordHeader = "X-Workbook-Password"
+
+// extractRequest holds the parameters of an upload
+type extractRequest struct {
+	companyNames      extractor.CompanyNameList
+	passwords         []string
+	template          string
+	includeProvenance bool
+}
+
+// handleExtract accepts a workbook either as the "file" part of a multipart
+// form or as the raw request body. Company names, template and provenance are
+// read from form fields or query parameters.
+func (s *server) handleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "extract requires POST")
+		return
+	}
+	if !s.acquire() {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "too many extractions in progress, retry later")
+		return
+	}
+	// the slot is handed to the extraction once it starts
+	extracting := false
+	defer func() {
+		if !extracting {
+			s.release()
+		}
+	}()
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadBytes)
+
+	var upload io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(s.maxUploadBytes); err != nil {
+			writeUploadError(w, err)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "multipart upload requires a \"file\" part")
+			return
+		}
+		defer file.Close()
+		upload = file
+	}
+
+	request := s.parseExtractRequest(r)
+	template, ok := s.templates[request.template]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown template: %s", request.template))
+		return
+	}
+
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	// Extraction runs on its own goroutine so a slow workbook cannot hold the
+	// request past the timeout. It stops at the next section, field or row once
+	// the request gave up, the buffered channel lets it close its extractor.
+	// Its slot is freed once it returns, which may be after the request.
+	results := make(chan fileResult, 1)
+	extracting = true
+	go func() {
+		result := extractFile(ctx, "upload", func() (*extractor.ExcelExtractor, error) {
+			return s.open(ctx, data, request.companyNames, template, &extractor.OpenOptions{Passwords: request.passwords, Limits: s.limits})
+		}, request.includeProvenance)
+		s.release()
+		results <- result
+	}()
+
+	var result fileResult
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		// the extraction stops at its next check and returns what it has
+		select {
+		case result = <-results:
+		case <-time.After(timeoutGrace):
+			// still opening the workbook, which cannot be interrupted
+			writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("extraction did not finish within %s", s.timeout))
+			return
+		}
+	}
+
+	code := http.StatusOK
+	switch {
+	case result.Status == statusError && result.ErrorCode == errorCodeLimitExceeded:
+		code = http.StatusRequestEntityTooLarge
+	case result.Status == statusError && (result.ErrorCode == errorCodeTimeout || result.ErrorCode == errorCodeCanceled):
+		code = http.StatusGatewayTimeout
+	case result.Status == statusError:
+		code = http.StatusUnprocessableEntity
+	}
+	writeResponse(w, code, extractResponse{Response: result.Response, ErrorCode: result.ErrorCode})
+}
+
+// acquire takes a slot for an extraction, false when all are in use
+func (s *server) acquire() bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees the slot of an extraction
+func (s *server) release() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// parseExtractRequest reads the parameters from the query and, for multipart
+// uploads, the form fields. The body of a raw upload is never parsed as a form.
+func (s *server) parseExtractRequest(r *http.Request) extractRequest {
+	values := r.URL.Query()
+	if r.MultipartForm != nil {
+		for key, formValues := range r.MultipartForm.Value {
+			values[key] = append(values[key], formValues...)
+		}
+	}
+
+	var companies stringList
+	for _, value := range values["company"] {
+		companies.Set(value)
+	}
+
+	// passwords are never read from the query, which ends up in access logs
+	request := extractRequest{
+		companyNames: extractor.CompanyNameList(companies),
+		template:     values.Get("template"),
+		passwords:    r.Header.Values(passwordHeader),
+	}
+	if r.MultipartForm != nil {
+		request.passwords = append(request.passwords, r.MultipartForm.Value["password"]...)
+	}
+	if len(request.companyNames) == 0 {
+		request.companyNames = s.companyNames
+	}
+	if request.template == "" {
+		request.template = builtInTemplate
+	}
+	request.includeProvenance, _ = strconv.ParseBool(values.Get("provenance"))
+	return request
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to read upload: %v", err))
+}
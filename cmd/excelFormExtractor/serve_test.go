@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adhadse/excelFormExtractor/pkg/extractor"
+)
+
+// newTestServer returns a server with the built-in template and the company
+// name "Amazon"
+func newTestServer() *server {
+	return &server{
+		companyNames:   extractor.CompanyNameList{"Amazon"},
+		templates:      map[string]*extractor.FormTemplate{builtInTemplate: extractor.DefaultSECCFTemplate()},
+		maxUploadBytes: 1 << 20,
+		timeout:        time.Minute,
+		open:           extractor.MakeTemplateExtractorFromBytesContext,
+	}
+}
+
+// testWorkbook returns an .xlsx workbook with the part number PN-1
+func testWorkbook(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "form.xlsx")
+	writeWorkbook(t, path, "PN-1")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// multipartBody returns a multipart form with the workbook as its "file" part,
+// when not nil, and the given fields
+func multipartBody(t *testing.T, workbook []byte, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if workbook != nil {
+		part, err := writer.CreateFormFile("file", "form.xlsx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(workbook)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, writer.FormDataContentType()
+}
+
+// serve sends the request to the server and decodes the JSON response
+func serve(t *testing.T, s *server, r *http.Request) (int, extractResponse) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	s.routes().ServeHTTP(recorder, r)
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("got content type %q, want application/json", contentType)
+	}
+	var response extractResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not JSON: %v: %s", err, recorder.Body.String())
+	}
+	return recorder.Code, response
+}
+
+func TestServeHealthAndVersion(t *testing.T) {
+	s := newTestServer()
+	s.templates["supplier"] = extractor.DefaultSECCFTemplate()
+	s.templates["buyer"] = extractor.DefaultSECCFTemplate()
+
+	code, response := serve(t, s, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if code != http.StatusOK || response.Status != statusSuccess {
+		t.Errorf("health: got %d %s, want %d %s", code, response.Status, http.StatusOK, statusSuccess)
+	}
+
+	code, response = serve(t, s, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if code != http.StatusOK || response.Status != statusSuccess {
+		t.Errorf("version: got %d %s, want %d %s", code, response.Status, http.StatusOK, statusSuccess)
+	}
+	data, _ := response.Data.(map[string]any)
+	if templates := fmt.Sprint(data["templates"]); templates != "[buyer seccf supplier]" {
+		t.Errorf("version: got templates %s, want them sorted: [buyer seccf supplier]", templates)
+	}
+	if data["version"] == "" || data["go_version"] == "" {
+		t.Errorf("version: got %v, want the version and the Go version", data)
+	}
+}
+
+func TestServeExtract(t *testing.T) {
+	workbook := testWorkbook(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        func(t *testing.T) (*bytes.Buffer, string)
+		server      func(s *server)
+		wantCode    int
+		wantStatus  string
+		wantMessage string
+		// error code of a workbook not opened or not fully extracted
+		wantErrorCode string
+	}{
+		{
+			name:   "raw upload",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: statusSuccess,
+		},
+		{
+			name:   "multipart upload with a template field",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return multipartBody(t, workbook, map[string]string{"template": builtInTemplate, "company": "Amazon"})
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: statusSuccess,
+		},
+		{
+			name:        "GET",
+			method:      http.MethodGet,
+			target:      "/extract",
+			wantCode:    http.StatusMethodNotAllowed,
+			wantStatus:  statusError,
+			wantMessage: "POST",
+		},
+		{
+			name:   "unknown template",
+			method: http.MethodPost,
+			target: "/extract?template=missing",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			wantCode:    http.StatusBadRequest,
+			wantStatus:  statusError,
+			wantMessage: "unknown template: missing",
+		},
+		{
+			name:   "multipart upload without a file",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return multipartBody(t, nil, map[string]string{"company": "Amazon"})
+			},
+			wantCode:    http.StatusBadRequest,
+			wantStatus:  statusError,
+			wantMessage: "\"file\" part",
+		},
+		{
+			name:   "raw upload over the size limit",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			server:      func(s *server) { s.maxUploadBytes = 100 },
+			wantCode:    http.StatusRequestEntityTooLarge,
+			wantStatus:  statusError,
+			wantMessage: "larger than 100 bytes",
+		},
+		{
+			name:   "multipart upload over the size limit",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return multipartBody(t, workbook, nil)
+			},
+			server:      func(s *server) { s.maxUploadBytes = 100 },
+			wantCode:    http.StatusRequestEntityTooLarge,
+			wantStatus:  statusError,
+			wantMessage: "larger than 100 bytes",
+		},
+		{
+			name:   "not a workbook",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBufferString("not a workbook"), "application/octet-stream"
+			},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantStatus:    statusError,
+			wantMessage:   "Failed to initialize extractor",
+			wantErrorCode: errorCodeOpenFailed,
+		},
+		{
+			name:   "partial extraction",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			server: func(s *server) {
+				template := extractor.DefaultSECCFTemplate()
+				template.Sections[0].Sheet = "no such sheet"
+				s.templates[builtInTemplate] = template
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: statusPartial,
+		},
+		{
+			name:   "timeout before opening",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			server:        func(s *server) { s.timeout = time.Nanosecond },
+			wantCode:      http.StatusGatewayTimeout,
+			wantStatus:    statusError,
+			wantMessage:   "canceled",
+			wantErrorCode: errorCodeTimeout,
+		},
+		{
+			name:   "timeout while extracting",
+			method: http.MethodPost,
+			target: "/extract",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				return bytes.NewBuffer(workbook), "application/octet-stream"
+			},
+			server: func(s *server) {
+				s.timeout = 10 * time.Millisecond
+				// the workbook opens just as the timeout passes
+				s.open = func(ctx context.Context, data []byte, companyNames extractor.CompanyNameList, template *extractor.FormTemplate, options *extractor.OpenOptions) (*extractor.ExcelExtractor, error) {
+					e, err := extractor.MakeTemplateExtractorFromBytes(data, companyNames, template)
+					<-ctx.Done()
+					return e, err
+				}
+			},
+			wantCode:      http.StatusOK,
+			wantStatus:    statusPartial,
+			wantMessage:   "canceled",
+			wantErrorCode: errorCodeTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer()
+			if test.server != nil {
+				test.server(s)
+			}
+			var r *http.Request
+			if test.body != nil {
+				body, contentType := test.body(t)
+				r = httptest.NewRequest(test.method, test.target, body)
+				r.Header.Set("Content-Type", contentType)
+			} else {
+				r = httptest.NewRequest(test.method, test.target, nil)
+			}
+
+			code, response := serve(t, s, r)
+			if code != test.wantCode || response.Status != test.wantStatus {
+				t.Errorf("got %d %s (%s), want %d %s", code, response.Status, response.Message, test.wantCode, test.wantStatus)
+			}
+			if !strings.Contains(response.Message, test.wantMessage) {
+				t.Errorf("got message %q, want it to contain %q", response.Message, test.wantMessage)
+			}
+			if response.ErrorCode != test.wantErrorCode {
+				t.Errorf("got error code %q, want %q", response.ErrorCode, test.wantErrorCode)
+			}
+			if test.wantStatus == statusSuccess {
+				data, _ := response.Data.(map[string]any)
+				buyerDetails, _ := data["buyer_details"].(map[string]any)
+				if buyerDetails["part_number"] != "PN-1" {
+					t.Errorf("got buyer details %v, want the part number PN-1", buyerDetails)
+				}
+			}
+		})
+	}
+}
+
+func TestServeExtractPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "form.xlsx")
+	writeWorkbook(t, path, "PN-1")
+	encryptWorkbook(t, path, "secret")
+	workbook, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		request       func(t *testing.T) *http.Request
+		wantCode      int
+		wantErrorCode string
+	}{
+		{
+			name: "header",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/extract", bytes.NewReader(workbook))
+				r.Header.Add(passwordHeader, "guess")
+				r.Header.Add(passwordHeader, "secret")
+				return r
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "multipart field",
+			request: func(t *testing.T) *http.Request {
+				body, contentType := multipartBody(t, workbook, map[string]string{"password": "secret"})
+				r := httptest.NewRequest(http.MethodPost, "/extract", body)
+				r.Header.Set("Content-Type", contentType)
+				return r
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "query parameter",
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/extract?password=secret", bytes.NewReader(workbook))
+			},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantErrorCode: errorCodePasswordRequired,
+		},
+		{
+			name: "wrong password",
+			request: func(t *testing.T) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/extract", bytes.NewReader(workbook))
+				r.Header.Set(passwordHeader, "guess")
+				return r
+			},
+			wantCode:      http.StatusUnprocessableEntity,
+			wantErrorCode: errorCodeWrongPassword,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, response := serve(t, newTestServer(), test.request(t))
+			if code != test.wantCode || response.ErrorCode != test.wantErrorCode {
+				t.Errorf("got %d %q (%s), want %d %q", code, response.ErrorCode, response.Message, test.wantCode, test.wantErrorCode)
+			}
+		})
+	}
+}
+
+func TestServeConcurrencyLimit(t *testing.T) {
+	workbook := testWorkbook(t)
+	s := newTestServer()
+	s.slots = make(chan struct{}, 1)
+	started, unblock := make(chan struct{}), make(chan struct{})
+	s.open = func(ctx context.Context, data []byte, companyNames extractor.CompanyNameList, template *extractor.FormTemplate, options *extractor.OpenOptions) (*extractor.ExcelExtractor, error) {
+		if started != nil {
+			close(started)
+			<-unblock
+		}
+		return extractor.MakeTemplateExtractorFromBytesContext(ctx, data, companyNames, template, options)
+	}
+	upload := func() *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/extract", bytes.NewReader(workbook))
+	}
+
+	// the first upload holds the only slot until it is unblocked
+	first := make(chan int)
+	go func() {
+		recorder := httptest.NewRecorder()
+		s.routes().ServeHTTP(recorder, upload())
+		first <- recorder.Code
+	}()
+	<-started
+
+	recorder := httptest.NewRecorder()
+	s.routes().ServeHTTP(recorder, upload())
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("while full: got %d, Retry-After %q, want %d and a Retry-After header", recorder.Code, recorder.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	started = nil
+	close(unblock)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first upload: got %d, want %d", code, http.StatusOK)
+	}
+	if code, response := serve(t, s, upload()); code != http.StatusOK {
+		t.Errorf("once freed: got %d (%s), want %d", code, response.Message, http.StatusOK)
+	}
+}
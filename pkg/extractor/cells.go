@@ -0,0 +1,104 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// offsetCell moves a cell reference by the given number of columns (right
+// when positive) and rows (down when positive)
+func offsetCell(cell string, colOffset int, rowOffset int) (string, error) {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return "", fmt.Errorf("invalid cell reference %q: %w", cell, err)
+	}
+
+	newCol, newRow := col+colOffset, row+rowOffset
+	if newCol < 1 || newCol > excelize.MaxColumns || newRow < 1 || newRow > excelize.TotalRows {
+		return "", fmt.Errorf("offset (%d columns, %d rows) from %s is outside the sheet", colOffset, rowOffset, cell)
+	}
+	return excelize.CoordinatesToCellName(newCol, newRow)
+}
+
+// getAdjacentRange returns the cell range moved by colOffset columns and
+// rowOffset rows
+func getAdjacentRange(cellRange CellRange, colOffset int, rowOffset int) (CellRange, error) {
+	startCell, err := offsetCell(cellRange.StartCell, colOffset, rowOffset)
+	if err != nil {
+		return CellRange{}, err
+	}
+
+	// Ranges found by label search only know their start cell
+	endCell := startCell
+	if cellRange.EndCell != "" {
+		if endCell, err = offsetCell(cellRange.EndCell, colOffset, rowOffset); err != nil {
+			return CellRange{}, err
+		}
+	}
+
+	return CellRange{
+		StartCell: startCell,
+		EndCell:   endCell,
+	}, nil
+}
+
+// region is a rectangular block of cells given by 1-based coordinates
+type region struct {
+	startCol, startRow int
+	endCol, endRow     int
+}
+
+func (r region) contains(col, row int) bool {
+	return col >= r.startCol && col <= r.endCol && row >= r.startRow && row <= r.endRow
+}
+
+// parseRegion converts a CellRange into a normalised region
+func parseRegion(cellRange CellRange) (region, error) {
+	startCol, startRow, err := excelize.CellNameToCoordinates(cellRange.StartCell)
+	if err != nil {
+		return region{}, fmt.Errorf("invalid search region start %q: %w", cellRange.StartCell, err)
+	}
+	endCol, endRow, err := excelize.CellNameToCoordinates(cellRange.EndCell)
+	if err != nil {
+		return region{}, fmt.Errorf("invalid search region end %q: %w", cellRange.EndCell, err)
+	}
+	if endCol < startCol {
+		startCol, endCol = endCol, startCol
+	}
+	if endRow < startRow {
+		startRow, endRow = endRow, startRow
+	}
+	return region{startCol: startCol, startRow: startRow, endCol: endCol, endRow: endRow}, nil
+}
+
+// parseCellReference splits a reference such as "$G$21" or "'Buyer Details'!G21"
+// into its sheet and cell. References without a sheet use defaultSheet.
+func parseCellReference(reference string, defaultSheet string) (string, string, error) {
+	reference = strings.TrimPrefix(strings.TrimSpace(reference), "=")
+
+	sheetName := defaultSheet
+	if idx := strings.LastIndex(reference, "!"); idx >= 0 {
+		sheetName = reference[:idx]
+		if len(sheetName) >= 2 && strings.HasPrefix(sheetName, "'") && strings.HasSuffix(sheetName, "'") {
+			sheetName = strings.ReplaceAll(sheetName[1:len(sheetName)-1], "''", "'")
+		}
+		reference = reference[idx+1:]
+	}
+
+	cell := strings.ReplaceAll(reference, "$", "")
+	if _, _, err := excelize.CellNameToCoordinates(cell); err != nil {
+		return "", "", fmt.Errorf("invalid cell reference %q: %w", reference, err)
+	}
+	return sheetName, cell, nil
+}
+
+// columnIndex returns the 0-based index of a column name, -1 when invalid
+func columnIndex(colName string) int {
+	col, err := excelize.ColumnNameToNumber(colName)
+	if err != nil {
+		return -1
+	}
+	return col - 1
+}
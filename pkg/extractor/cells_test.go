@@ -0,0 +1,43 @@
+package extractor
+
+import "testing"
+
+func TestGetAdjacentRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		cellRange CellRange
+		colOffset int
+		rowOffset int
+		want      CellRange
+		wantErr   bool
+	}{
+		{name: "right", cellRange: CellRange{StartCell: "B12", EndCell: "D12"}, colOffset: 3, want: CellRange{StartCell: "E12", EndCell: "G12"}},
+		{name: "past column Z", cellRange: CellRange{StartCell: "Z5", EndCell: "Z5"}, colOffset: 1, want: CellRange{StartCell: "AA5", EndCell: "AA5"}},
+		{name: "across column Z", cellRange: CellRange{StartCell: "Y3", EndCell: "AB3"}, colOffset: 2, want: CellRange{StartCell: "AA3", EndCell: "AD3"}},
+		{name: "past column AZ", cellRange: CellRange{StartCell: "AY1", EndCell: "AZ1"}, colOffset: 2, want: CellRange{StartCell: "BA1", EndCell: "BB1"}},
+		{name: "left", cellRange: CellRange{StartCell: "AB7", EndCell: "AC7"}, colOffset: -2, want: CellRange{StartCell: "Z7", EndCell: "AA7"}},
+		{name: "down", cellRange: CellRange{StartCell: "B2", EndCell: "C2"}, rowOffset: 2, want: CellRange{StartCell: "B4", EndCell: "C4"}},
+		{name: "start cell only", cellRange: CellRange{StartCell: "C9"}, colOffset: 1, rowOffset: -1, want: CellRange{StartCell: "D8", EndCell: "D8"}},
+		{name: "before column A", cellRange: CellRange{StartCell: "A1", EndCell: "B1"}, colOffset: -1, wantErr: true},
+		{name: "above row 1", cellRange: CellRange{StartCell: "A1"}, rowOffset: -1, wantErr: true},
+		{name: "invalid cell", cellRange: CellRange{StartCell: "1A"}, colOffset: 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := getAdjacentRange(test.cellRange, test.colOffset, test.rowOffset)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
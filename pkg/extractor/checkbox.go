@@ -0,0 +1,465 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Ways a checkbox state was detected
+const (
+	DetectionFormControl = "form_control" // Checked flag of the form control
+	DetectionLinkedCell  = "linked_cell"  // TRUE/FALSE in the cell bound to the control
+	DetectionGlyph       = "glyph"        // mark typed into the cell, for forms without controls
+)
+
+// DefaultCheckMarks are the cell values read as a ticked option when a form
+// has no checkbox controls. Comparison ignores case.
+var DefaultCheckMarks = []string{"x", "✓", "✔", "☒", "☑", "■", "yes"}
+
+// DefaultUncheckedMarks are the cell values read as an explicitly unticked option
+var DefaultUncheckedMarks = []string{"☐", "□"}
+
+const (
+	// DefaultCheckBoxTolerance is how far, in pixels, a checkbox may sit
+	// outside its target cell and still be associated with it
+	DefaultCheckBoxTolerance = 24.0
+
+	// size assumed for controls that do not report their own size
+	defaultCheckBoxWidth  = 16.0
+	defaultCheckBoxHeight = 16.0
+)
+
+// CheckBoxMatch records which checkbox was associated with a target cell and
+// how far from the cell it was found
+type CheckBoxMatch struct {
+	Field       string  `json:"field"`
+	Option      string  `json:"option,omitempty"` // classification label the checkbox stands for
+	SheetName   string  `json:"sheet_name"`
+	TargetCell  string  `json:"target_cell"`
+	ControlCell string  `json:"control_cell,omitempty"` // anchor cell of the chosen checkbox
+	ControlText string  `json:"control_text,omitempty"`
+	Distance    float64 `json:"distance"` // pixels between the checkbox and the target cell
+	Found       bool    `json:"found"`
+	Checked     bool    `json:"checked"` // final state, the linked cell wins over the control
+	// state stored on the control itself
+	ControlChecked bool `json:"control_checked"`
+	// cell the checkbox is bound to and the value found there
+	LinkedCell  string `json:"linked_cell,omitempty"`
+	LinkedValue string `json:"linked_value,omitempty"`
+	// Conflict is set when the linked cell and the control disagree
+	Conflict bool `json:"conflict,omitempty"`
+	// LinkError tells why the linked cell could not be read, e.g. a link
+	// left as "#REF!" by deleting its cell. The control's own state is used.
+	LinkError string `json:"link_error,omitempty"`
+	// Method is one of the Detection* constants, empty when nothing was found
+	Method string `json:"method,omitempty"`
+	// text of the target cell when the state was read from a typed mark
+	CellText string `json:"cell_text,omitempty"`
+	// Undecidable is set when a mark was typed into a cell shared by several
+	// options without telling which of them it ticks
+	Undecidable bool `json:"undecidable,omitempty"`
+}
+
+// sheetGeometry converts cell coordinates into pixel positions. Column and
+// row edges are computed lazily and kept for the lifetime of the extractor.
+type sheetGeometry struct {
+	colEdges []float64 // colEdges[i] is the left edge of column i+1
+	rowEdges []float64 // rowEdges[i] is the top edge of row i+1
+}
+
+func (e *ExcelExtractor) getSheetGeometry(sheetName string) *sheetGeometry {
+	if geometry, ok := e.geometries[sheetName]; ok {
+		return geometry
+	}
+	if e.geometries == nil {
+		e.geometries = map[string]*sheetGeometry{}
+	}
+	geometry := &sheetGeometry{colEdges: []float64{0}, rowEdges: []float64{0}}
+	e.geometries[sheetName] = geometry
+	return geometry
+}
+
+// colEdge returns the left edge of a column in pixels
+func (e *ExcelExtractor) colEdge(sheetName string, col int) (float64, error) {
+	geometry := e.getSheetGeometry(sheetName)
+	for len(geometry.colEdges) < col {
+		n := len(geometry.colEdges)
+		width, err := e.workbook.ColumnWidth(sheetName, n)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get column width: %w", err)
+		}
+		geometry.colEdges = append(geometry.colEdges, geometry.colEdges[n-1]+colWidthToPixels(width))
+	}
+	return geometry.colEdges[col-1], nil
+}
+
+// rowEdge returns the top edge of a row in pixels
+func (e *ExcelExtractor) rowEdge(sheetName string, row int) (float64, error) {
+	geometry := e.getSheetGeometry(sheetName)
+	for len(geometry.rowEdges) < row {
+		n := len(geometry.rowEdges)
+		height, err := e.workbook.RowHeight(sheetName, n)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get row height: %w", err)
+		}
+		geometry.rowEdges = append(geometry.rowEdges, geometry.rowEdges[n-1]+rowHeightToPixels(height))
+	}
+	return geometry.rowEdges[row-1], nil
+}
+
+// cellRect returns the pixel rectangle covered by a cell
+func (e *ExcelExtractor) cellRect(sheetName string, cell string) (x0, y0, x1, y1 float64, err error) {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid cell reference %q: %w", cell, err)
+	}
+	if x0, err = e.colEdge(sheetName, col); err != nil {
+		return
+	}
+	if x1, err = e.colEdge(sheetName, col+1); err != nil {
+		return
+	}
+	if y0, err = e.rowEdge(sheetName, row); err != nil {
+		return
+	}
+	y1, err = e.rowEdge(sheetName, row+1)
+	return
+}
+
+// controlCenter returns the centre of a form control in pixels, computed from
+// its anchor cell and offsets
+func (e *ExcelExtractor) controlCenter(sheetName string, control FormControl) (float64, float64, error) {
+	x0, y0, _, _, err := e.cellRect(sheetName, control.Cell)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	width, height := float64(control.Width), float64(control.Height)
+	if width == 0 {
+		width = defaultCheckBoxWidth
+	}
+	if height == 0 {
+		height = defaultCheckBoxHeight
+	}
+	return x0 + float64(control.OffsetX) + width/2, y0 + float64(control.OffsetY) + height/2, nil
+}
+
+// getFormControls returns the form controls of a sheet
+func (e *ExcelExtractor) getFormControls(sheetName string) ([]FormControl, error) {
+	snapshot, err := e.getSnapshot(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.formControls, nil
+}
+
+// checkBoxTolerance returns the tolerance configured for a field, falling back
+// to the template and then to DefaultCheckBoxTolerance
+func (e *ExcelExtractor) checkBoxTolerance(criteria SearchCriteria) float64 {
+	if criteria.CheckBoxTolerance > 0 {
+		return criteria.CheckBoxTolerance
+	}
+	if e.template != nil && e.template.CheckBoxTolerance > 0 {
+		return e.template.CheckBoxTolerance
+	}
+	return DefaultCheckBoxTolerance
+}
+
+// controlText returns the text shown next to a form control
+func controlText(control FormControl) string {
+	text := control.Text
+	for _, run := range control.Paragraph {
+		text += run
+	}
+	return strings.TrimSpace(text)
+}
+
+// controlHasText reports whether a control is labelled with one of the texts
+func controlHasText(control FormControl, classificationTexts []string) bool {
+	for _, text := range classificationTexts {
+		for _, paraText := range control.Paragraph {
+			if strings.EqualFold(paraText, text) {
+				return true
+			}
+		}
+		if strings.EqualFold(controlText(control), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCheckBoxChecked finds the checkbox labelled with one of the classification
+// texts that is nearest to cell, within tolerance pixels, and reports its state.
+// otherTexts are the texts of the other options whose target is cell too.
+func (e *ExcelExtractor) isCheckBoxChecked(sheetName string, cell string, classificationTexts []string, otherTexts []string, tolerance float64) (CheckBoxMatch, error) {
+	match := CheckBoxMatch{
+		SheetName:  sheetName,
+		TargetCell: cell,
+	}
+
+	formControls, err := e.getFormControls(sheetName)
+	if err != nil {
+		return match, err
+	}
+
+	x0, y0, x1, y1, err := e.cellRect(sheetName, cell)
+	if err != nil {
+		return match, err
+	}
+
+	var chosen *FormControl
+	hasCheckBoxes := false
+	for i, control := range formControls {
+		if control.Type != FormControlCheckBox {
+			continue
+		}
+		hasCheckBoxes = true
+		if !controlHasText(control, classificationTexts) {
+			continue
+		}
+
+		x, y, err := e.controlCenter(sheetName, control)
+		if err != nil {
+			return match, err
+		}
+
+		// Distance from the centre of the checkbox to the target cell, 0 when inside
+		dx := math.Max(0, math.Max(x0-x, x-x1))
+		dy := math.Max(0, math.Max(y0-y, y-y1))
+		distance := math.Hypot(dx, dy)
+
+		if distance > tolerance || (match.Found && distance >= match.Distance) {
+			continue
+		}
+		match.Found = true
+		match.Distance = distance
+		chosen = &formControls[i]
+	}
+
+	if chosen == nil {
+		if hasCheckBoxes {
+			return match, nil
+		}
+		// No checkbox control, the form may have been re-saved without them
+		return e.detectGlyph(match, classificationTexts, otherTexts)
+	}
+	match.Method = DetectionFormControl
+	match.ControlCell = chosen.Cell
+	match.ControlText = controlText(*chosen)
+	match.ControlChecked = chosen.Checked
+	match.Checked = chosen.Checked
+
+	if chosen.CellLink != "" {
+		if err := e.applyLinkedCell(&match, *chosen); err != nil {
+			return match, err
+		}
+	}
+	return match, nil
+}
+
+// applyLinkedCell reads the cell a checkbox is bound to. A TRUE/FALSE value
+// there is authoritative, since suppliers sometimes edit the cell instead of
+// the control. A link to a cell or sheet that no longer exists keeps the
+// state of the control.
+func (e *ExcelExtractor) applyLinkedCell(match *CheckBoxMatch, control FormControl) error {
+	match.LinkedCell = control.CellLink
+	linkedSheet, linkedCell, err := parseCellReference(control.CellLink, match.SheetName)
+	if err != nil {
+		match.LinkError = err.Error()
+		return nil
+	}
+	if !e.hasSheet(linkedSheet) {
+		match.LinkError = fmt.Sprintf("sheet %s not found", linkedSheet)
+		return nil
+	}
+
+	snapshot, err := e.getSnapshot(linkedSheet)
+	if err != nil {
+		return fmt.Errorf("failed to get linked cell value: %w", err)
+	}
+	value, err := snapshot.cellValue(linkedCell)
+	if err != nil {
+		return fmt.Errorf("failed to get linked cell value: %w", err)
+	}
+
+	match.LinkedValue = strings.TrimSpace(value)
+
+	linkedChecked, ok := parseLinkedValue(match.LinkedValue)
+	if !ok {
+		return nil
+	}
+	match.Method = DetectionLinkedCell
+	match.Checked = linkedChecked
+	match.Conflict = linkedChecked != control.Checked
+	return nil
+}
+
+// hasSheet tells whether the workbook has a sheet of that name
+func (e *ExcelExtractor) hasSheet(sheetName string) bool {
+	for _, name := range e.workbook.SheetNames() {
+		if name == sheetName {
+			return true
+		}
+	}
+	return false
+}
+
+// detectGlyph reads the target cell for a typed mark such as "X", "☒" or
+// "Yes". The option text itself may be in the cell too, e.g. "☒ YES". A cell
+// shared with other options only ticks the option it names alone.
+func (e *ExcelExtractor) detectGlyph(match CheckBoxMatch, classificationTexts []string, otherTexts []string) (CheckBoxMatch, error) {
+	value, _, err := e.readCell(match.SheetName, match.TargetCell)
+	if err != nil {
+		return match, err
+	}
+	if value == "" {
+		return match, nil
+	}
+
+	if len(otherTexts) > 0 {
+		own, other := containsWord(value, classificationTexts), containsWord(value, otherTexts)
+		switch {
+		case other && !own:
+			// the mark is another option's
+			match.Found = true
+			match.Method = DetectionGlyph
+			match.CellText = value
+			return match, nil
+		case own == other:
+			if _, found := e.parseMark(stripTexts(value, append(classificationTexts, otherTexts...))); found {
+				match.Found = true
+				match.Method = DetectionGlyph
+				match.CellText = value
+				match.Undecidable = true
+			}
+			return match, nil
+		}
+	}
+
+	// a cell holding nothing but the option text is its printed label
+	rest := stripTexts(value, classificationTexts)
+	if markText(rest) == "" {
+		return match, nil
+	}
+	checked, found := e.parseMark(value)
+	if !found {
+		// Drop the option text and look at what is left
+		checked, found = e.parseMark(rest)
+	}
+	if !found {
+		return match, nil
+	}
+
+	match.Found = true
+	match.Method = DetectionGlyph
+	match.CellText = value
+	match.Checked = checked
+	return match, nil
+}
+
+// parseMark reports whether value is one of the configured check marks. The
+// second result is false when value is no mark at all.
+func (e *ExcelExtractor) parseMark(value string) (bool, bool) {
+	value = markText(value)
+	if value == "" {
+		return false, false
+	}
+
+	checkMarks, uncheckedMarks := DefaultCheckMarks, DefaultUncheckedMarks
+	if e.template != nil && len(e.template.CheckMarks) > 0 {
+		checkMarks = e.template.CheckMarks
+	}
+	if e.template != nil && len(e.template.UncheckedMarks) > 0 {
+		uncheckedMarks = e.template.UncheckedMarks
+	}
+
+	for _, mark := range checkMarks {
+		if strings.EqualFold(value, mark) {
+			return true, true
+		}
+	}
+	for _, mark := range uncheckedMarks {
+		if strings.EqualFold(value, mark) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// markText trims the spaces and brackets around a typed mark
+func markText(value string) string {
+	return strings.TrimSpace(strings.Trim(strings.TrimSpace(value), "()[]:-"))
+}
+
+// parseLinkedValue interprets the value of a checkbox linked cell
+func parseLinkedValue(value string) (bool, bool) {
+	switch strings.ToUpper(value) {
+	case "TRUE", "1":
+		return true, true
+	case "FALSE", "0":
+		return false, true
+	}
+	return false, false
+}
+
+func colWidthToPixels(width float64) float64 {
+	if width == 0 {
+		return 0
+	}
+	if width < 1 {
+		return math.Ceil(width*12 + 0.5)
+	}
+	return math.Ceil(width*7 + 0.5 + 5)
+}
+
+func rowHeightToPixels(height float64) float64 {
+	return math.Ceil(height * 4 / 3)
+}
+
+// stripTexts removes the texts from value, ignoring case
+func stripTexts(value string, texts []string) string {
+	value = strings.ToLower(value)
+	for _, text := range texts {
+		if text != "" {
+			value = strings.ReplaceAll(value, strings.ToLower(text), " ")
+		}
+	}
+	return value
+}
+
+// containsWord tells whether one of the texts appears in value as whole
+// words, ignoring case, so "NO" is not found in "NOT ADVISED"
+func containsWord(value string, texts []string) bool {
+	value = strings.ToLower(value)
+	for _, text := range texts {
+		text = strings.ToLower(strings.TrimSpace(text))
+		if text == "" {
+			continue
+		}
+		for start := 0; ; {
+			i := strings.Index(value[start:], text)
+			if i < 0 {
+				break
+			}
+			i += start
+			end := i + len(text)
+			before, _ := utf8.DecodeLastRuneInString(value[:i])
+			after, _ := utf8.DecodeRuneInString(value[end:])
+			if !isWordRune(before) && !isWordRune(after) {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,339 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsCheckBoxChecked(t *testing.T) {
+	tests := []struct {
+		name      string
+		controls  []FormControl
+		values    map[string]string
+		tolerance float64
+		want      CheckBoxMatch
+		// the linked cell cannot be read, LinkError is checked apart
+		wantLinkError bool
+	}{
+		{
+			name:      "control in the cell",
+			controls:  []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, Checked: true, ControlChecked: true, Method: DetectionFormControl},
+		},
+		{
+			name:      "control next to the cell within tolerance",
+			controls:  []FormControl{{Cell: "E5", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{ControlCell: "E5", ControlText: "YES", Distance: 8, Found: true, Checked: true, ControlChecked: true, Method: DetectionFormControl},
+		},
+		{
+			name:      "control past the tolerance",
+			controls:  []FormControl{{Cell: "F5", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+			values:    map[string]string{"D5": "X"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{},
+		},
+		{
+			name:      "control within a wider tolerance",
+			controls:  []FormControl{{Cell: "F5", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+			tolerance: 100,
+			want:      CheckBoxMatch{ControlCell: "F5", ControlText: "YES", Distance: 78, Found: true, Checked: true, ControlChecked: true, Method: DetectionFormControl},
+		},
+		{
+			name: "nearest of two controls",
+			controls: []FormControl{
+				{Cell: "F5", Type: FormControlCheckBox, Text: "YES"},
+				{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true},
+			},
+			tolerance: 100,
+			want:      CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, Checked: true, ControlChecked: true, Method: DetectionFormControl},
+		},
+		{
+			name:      "control with another label",
+			controls:  []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "NO", Checked: true}},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{},
+		},
+		{
+			name:      "linked cell agreeing with the control",
+			controls:  []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "H5"}},
+			values:    map[string]string{"H5": "TRUE"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, Checked: true, ControlChecked: true, LinkedCell: "H5", LinkedValue: "TRUE", Method: DetectionLinkedCell},
+		},
+		{
+			name:      "linked cell conflicting with the control",
+			controls:  []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "Sheet1!$H$5"}},
+			values:    map[string]string{"H5": "FALSE"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, ControlChecked: true, LinkedCell: "Sheet1!$H$5", LinkedValue: "FALSE", Conflict: true, Method: DetectionLinkedCell},
+		},
+		{
+			name:      "linked cell without a boolean",
+			controls:  []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "H5"}},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, Checked: true, ControlChecked: true, LinkedCell: "H5", Method: DetectionFormControl},
+		},
+		{
+			name:          "dangling linked cell",
+			controls:      []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "#REF!"}},
+			tolerance:     DefaultCheckBoxTolerance,
+			want:          CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, Checked: true, ControlChecked: true, LinkedCell: "#REF!", Method: DetectionFormControl},
+			wantLinkError: true,
+		},
+		{
+			name:          "linked cell on a deleted sheet",
+			controls:      []FormControl{{Cell: "D5", Type: FormControlCheckBox, Text: "YES", CellLink: "Deleted!$H$5"}},
+			tolerance:     DefaultCheckBoxTolerance,
+			want:          CheckBoxMatch{ControlCell: "D5", ControlText: "YES", Found: true, LinkedCell: "Deleted!$H$5", Method: DetectionFormControl},
+			wantLinkError: true,
+		},
+		{
+			name:      "typed mark without controls",
+			values:    map[string]string{"D5": "X"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{Found: true, Checked: true, Method: DetectionGlyph, CellText: "X"},
+		},
+		{
+			name:      "ticked mark next to the option text",
+			values:    map[string]string{"D5": "☒ YES"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{Found: true, Checked: true, Method: DetectionGlyph, CellText: "☒ YES"},
+		},
+		{
+			name:      "option text alone",
+			values:    map[string]string{"D5": "YES"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{},
+		},
+		{
+			name:      "option text in brackets",
+			values:    map[string]string{"D5": "(Yes)"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{},
+		},
+		{
+			name:      "unticked mark without controls",
+			values:    map[string]string{"D5": "☐ YES"},
+			tolerance: DefaultCheckBoxTolerance,
+			want:      CheckBoxMatch{Found: true, Method: DetectionGlyph, CellText: "☐ YES"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestExtractor(t, nil, testSheet{name: "Sheet1", values: test.values, controls: test.controls})
+
+			got, err := e.isCheckBoxChecked("Sheet1", "D5", []string{"YES"}, nil, test.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got.LinkError != "") != test.wantLinkError {
+				t.Errorf("got link error %q, want one: %v", got.LinkError, test.wantLinkError)
+			}
+			got.LinkError = ""
+			test.want.SheetName, test.want.TargetCell = "Sheet1", "D5"
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDanglingLinkedCellDiagnostic(t *testing.T) {
+	template := &FormTemplate{
+		Name: "dangling link",
+		Sections: []SectionTemplate{{
+			Name:  SectionBuyerDetails,
+			Sheet: "buyer details",
+			Fields: map[string]SearchCriteria{
+				"BuildToPrint": {
+					SearchTerms:     []string{"build to print"},
+					CellRanges:      []CellRange{{StartCell: "B21", EndCell: "F21"}},
+					BoolCheckBox:    true,
+					BoolClfCriteria: BoolClassificationCriteria{Offset: 4, SearchTerms: []string{"YES"}},
+				},
+			},
+		}},
+	}
+	e := newTestExtractor(t, template, testSheet{
+		name:     "Buyer Details",
+		values:   map[string]string{"B21": "Build To Print"},
+		controls: []FormControl{{Cell: "F21", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "#REF!"}},
+	})
+
+	extraction, err := e.ExtractWithError()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extraction.BuyerDetails == nil || !extraction.BuyerDetails.BuildToPrint {
+		t.Errorf("got buyer details %+v, want BuildToPrint from the control", extraction.BuyerDetails)
+	}
+	if len(extraction.Diagnostics) != 1 {
+		t.Fatalf("got diagnostics %+v, want one", extraction.Diagnostics)
+	}
+	got := extraction.Diagnostics[0]
+	if got.Code != DiagnosticLinkedCellBroken || got.Severity != SeverityWarning || got.Field != "BuildToPrint" || got.Cell != "F21" {
+		t.Errorf("got diagnostic %+v, want a %s warning for BuildToPrint at F21", got, DiagnosticLinkedCellBroken)
+	}
+}
+
+func TestOptionGroupExtractor(t *testing.T) {
+	separateCells := SearchCriteria{Options: []ClassificationCriteria{
+		{Label: "YES", SearchTerms: []string{"YES"}, Offset: 2},
+		{Label: "NO", SearchTerms: []string{"No"}, Offset: 3},
+	}}
+	sharedCell := SearchCriteria{Options: []ClassificationCriteria{
+		{Label: "YES", SearchTerms: []string{"YES"}, Offset: 2},
+		{Label: "NO", SearchTerms: []string{"NO"}, Offset: 2},
+		{Label: "END USER NOT ADVISED", SearchTerms: []string{"END USER NOT ADVISED"}, Offset: 2},
+	}}
+
+	tests := []struct {
+		name     string
+		criteria SearchCriteria
+		controls []FormControl
+		values   map[string]string
+		want     OptionResult
+	}{
+		{
+			name:     "none checked",
+			criteria: separateCells,
+			controls: []FormControl{
+				{Cell: "D5", Type: FormControlCheckBox, Text: "YES"},
+				{Cell: "E5", Type: FormControlCheckBox, Text: "No"},
+			},
+			want: OptionResult{Status: OptionNone, Options: []string{"YES", "NO"}},
+		},
+		{
+			name:     "one selected",
+			criteria: separateCells,
+			controls: []FormControl{
+				{Cell: "D5", Type: FormControlCheckBox, Text: "YES"},
+				{Cell: "E5", Type: FormControlCheckBox, Text: "No", Checked: true},
+			},
+			want: OptionResult{Status: OptionSelected, Selected: "NO"},
+		},
+		{
+			name:     "both checked",
+			criteria: separateCells,
+			controls: []FormControl{
+				{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true},
+				{Cell: "E5", Type: FormControlCheckBox, Text: "No", Checked: true},
+			},
+			want: OptionResult{Status: OptionConflict, Options: []string{"YES", "NO"}},
+		},
+		{
+			name:     "linked cell overriding a control",
+			criteria: separateCells,
+			controls: []FormControl{
+				{Cell: "D5", Type: FormControlCheckBox, Text: "YES", Checked: true, CellLink: "H5"},
+				{Cell: "E5", Type: FormControlCheckBox, Text: "No", Checked: true},
+			},
+			values: map[string]string{"H5": "FALSE"},
+			want:   OptionResult{Status: OptionSelected, Selected: "NO"},
+		},
+		{
+			name:     "typed marks in separate cells",
+			criteria: separateCells,
+			values:   map[string]string{"E5": "x"},
+			want:     OptionResult{Status: OptionSelected, Selected: "NO"},
+		},
+		{
+			name:     "option labels in separate cells",
+			criteria: separateCells,
+			values:   map[string]string{"D5": "YES", "E5": "NO"},
+			want:     OptionResult{Status: OptionNone, Options: []string{"YES", "NO"}},
+		},
+		{
+			name:     "bare mark in a shared cell",
+			criteria: sharedCell,
+			values:   map[string]string{"D5": "X"},
+			want:     OptionResult{Status: OptionUndecidable, Options: []string{"YES", "NO", "END USER NOT ADVISED"}},
+		},
+		{
+			name:     "mark next to an option in a shared cell",
+			criteria: sharedCell,
+			values:   map[string]string{"D5": "☒ NO"},
+			want:     OptionResult{Status: OptionSelected, Selected: "NO"},
+		},
+		{
+			name:     "option containing another's label in a shared cell",
+			criteria: sharedCell,
+			values:   map[string]string{"D5": "☒ END USER NOT ADVISED"},
+			want:     OptionResult{Status: OptionSelected, Selected: "END USER NOT ADVISED"},
+		},
+		{
+			name:     "empty shared cell",
+			criteria: sharedCell,
+			want:     OptionResult{Status: OptionNone, Options: []string{"YES", "NO", "END USER NOT ADVISED"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestExtractor(t, nil, testSheet{name: "Sheet1", values: test.values, controls: test.controls})
+
+			value, err := (&OptionGroupExtractor{}).Extract(e, "Sheet1", test.criteria, CellRange{StartCell: "B5", EndCell: "B5"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := *value.(FieldValue).Option
+			if got.Status != test.want.Status || got.Selected != test.want.Selected || !reflect.DeepEqual(got.Options, test.want.Options) {
+				t.Errorf("got %s %q %q, want %s %q %q", got.Status, got.Selected, got.Options, test.want.Status, test.want.Selected, test.want.Options)
+			}
+			if len(got.Matches) != len(test.criteria.Options) {
+				t.Errorf("got %d matches, want one per option", len(got.Matches))
+			}
+		})
+	}
+}
+
+func TestBoolCheckBoxExtractor(t *testing.T) {
+	criteria := SearchCriteria{BoolCheckBox: true, BoolClfCriteria: BoolClassificationCriteria{Offset: 2, SearchTerms: []string{"YES"}}}
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "typed mark", value: "X", want: true},
+		{name: "mark next to the label", value: "☒ Yes", want: true},
+		{name: "printed label", value: "YES"},
+		{name: "empty cell"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestExtractor(t, nil, testSheet{name: "Sheet1", values: map[string]string{"D5": test.value}})
+
+			value, err := (&BoolCheckBoxExtractor{}).Extract(e, "Sheet1", criteria, CellRange{StartCell: "B5", EndCell: "B5"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := value.(FieldValue).Value; got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		value string
+		texts []string
+		want  bool
+	}{
+		{"☒ NO", []string{"no"}, true},
+		{"END USER NOT ADVISED", []string{"NO"}, false},
+		{"DUAL", []string{"DU"}, false},
+		{"x DU", []string{"DU"}, true},
+		{"Yes/No", []string{"no"}, true},
+		{"", []string{"no"}, false},
+	}
+	for _, test := range tests {
+		if got := containsWord(test.value, test.texts); got != test.want {
+			t.Errorf("containsWord(%q, %q) = %v, want %v", test.value, test.texts, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// StreamControlledContent extracts the controlled content table of the
+// template row by row and hands every row to fn, so tables with tens of
+// thousands of rows are never held in memory. The rows are not added to
+// Extraction.ControlledContent. An error returned by fn stops the extraction
+// and is returned, as does a CanceledError once the context of the extractor
+// is done. Problems found are added to Extraction.Diagnostics.
+func (e *ExcelExtractor) StreamControlledContent(fn func(content ControlCotent) error) (*HeaderMatch, error) {
+	for _, section := range e.template.Sections {
+		if section.Name != SectionControlledContent {
+			continue
+		}
+
+		_, sheetName, err := e.searchSheetName(section.Sheet)
+		if err != nil {
+			e.errorf(DiagnosticSheetNotFound, section.Name, "", "", "", "%v", err)
+			return nil, err
+		}
+		return e.streamControlledContent(sheetName, e.expandColumns(section.Columns), section.HeaderScanRows, fn)
+	}
+	return nil, fmt.Errorf("template %s has no %s section", e.template.Name, SectionControlledContent)
+}
+
+// streamControlledContent finds the header row, then reads the rows below it
+// until the first one without a value in the first mapped column
+func (e *ExcelExtractor) streamControlledContent(sheetName string, columnMappings []ColumnMapping, headerScanRows int, fn func(content ControlCotent) error) (*HeaderMatch, error) {
+	header, err := e.findHeaderRow(sheetName, columnMappings, headerScanRows)
+	if err != nil {
+		e.recordLimit(err)
+		var canceled CanceledError
+		if !errors.As(err, &canceled) {
+			e.errorf(DiagnosticHeaderNotFound, SectionControlledContent, "", sheetName, "", "%v in sheet %s", err, sheetName)
+		}
+		return nil, err
+	}
+
+	// Find actual columns for each mapping
+	for i := range columnMappings {
+		col, found := findColumnByHeader(header.texts, columnMappings[i].SearchTerms)
+		if !found {
+			e.warnf(DiagnosticColumnNotFound, SectionControlledContent, columnMappings[i].FieldName, sheetName, "", "could not find column for %s in header row %d: search terms %v", columnMappings[i].FieldName, header.Row, columnMappings[i].SearchTerms)
+			continue
+		}
+		columnMappings[i].FoundColumn = col
+	}
+
+	// Start from the row after header, a row is empty when its first column is
+	lastRow := header.DataRow() - 1
+	var fnErr error
+	if len(columnMappings) > 0 && columnMappings[0].FoundColumn != "" {
+		firstCol := columnIndex(columnMappings[0].FoundColumn)
+		err = e.workbook.IterateRows(sheetName, func(row int, values []string) bool {
+			if fnErr = e.checkContext(SectionControlledContent); fnErr != nil {
+				return false
+			}
+			if row < header.DataRow() {
+				return true
+			}
+			if rowValue(values, firstCol) == "" {
+				return false
+			}
+
+			content := ControlCotent{
+				SheetName: sheetName,
+			}
+
+			// Use reflection to set fields dynamically
+			contentValue := reflect.ValueOf(&content).Elem()
+
+			for _, mapping := range columnMappings {
+				if mapping.FoundColumn == "" {
+					continue
+				}
+
+				field := contentValue.FieldByName(mapping.FieldName)
+				if field.IsValid() && field.CanSet() {
+					field.SetString(strings.TrimSpace(rowValue(values, columnIndex(mapping.FoundColumn))))
+				}
+			}
+
+			if fnErr = fn(content); fnErr != nil {
+				return false
+			}
+			lastRow = row
+			return true
+		})
+	}
+
+	// Record the column every field was read from
+	for _, mapping := range columnMappings {
+		if mapping.FoundColumn == "" {
+			continue
+		}
+		provenance := FieldProvenance{
+			Section:   SectionControlledContent,
+			Field:     mapping.FieldName,
+			SheetName: sheetName,
+			LabelCell: fmt.Sprintf("%s%d", mapping.FoundColumn, header.Row),
+			LabelText: header.texts[columnIndex(mapping.FoundColumn)],
+			Extractor: "ColumnMapping",
+		}
+		if lastRow >= header.DataRow() {
+			provenance.ValueCells = []string{fmt.Sprintf("%s%d:%s%d", mapping.FoundColumn, header.DataRow(), mapping.FoundColumn, lastRow)}
+		}
+		e.recordProvenance(provenance)
+	}
+
+	if err != nil {
+		e.recordLimit(err)
+		e.errorf(DiagnosticExtractorFailed, SectionControlledContent, "", sheetName, "", "failed to read rows of sheet %s: %v", sheetName, err)
+		return header, fmt.Errorf("failed to get rows: %w", err)
+	}
+	return header, fnErr
+}
+
+// rowValue returns the value of the 0-based column of a row, empty past its
+// last cell
+func rowValue(values []string, col int) string {
+	if col < 0 || col >= len(values) {
+		return ""
+	}
+	return values[col]
+}
@@ -0,0 +1,65 @@
+package extractor
+
+import "fmt"
+
+// Severity of a diagnostic
+const (
+	SeverityWarning = "warning" // the value is missing, the rest of the section is fine
+	SeverityError   = "error"   // a field or section could not be extracted
+)
+
+// Diagnostic codes
+const (
+	DiagnosticSheetNotFound    = "sheet_not_found"
+	DiagnosticFieldNotFound    = "field_not_found"
+	DiagnosticHeaderNotFound   = "header_not_found"
+	DiagnosticColumnNotFound   = "column_not_found"
+	DiagnosticExtractorFailed  = "extractor_failed"
+	DiagnosticFieldNotSettable = "field_not_settable"
+	DiagnosticCanceled         = "canceled"
+	DiagnosticLinkedCellBroken = "linked_cell_broken"
+	DiagnosticNoCompanyNames   = "no_company_names"
+)
+
+// Diagnostic is a problem met during extraction. Extraction never prints,
+// everything worth telling the caller ends up in SECCFExtraction.Diagnostics.
+type Diagnostic struct {
+	Code      string `json:"code"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Section   string `json:"section,omitempty"`
+	Field     string `json:"field,omitempty"`
+	SheetName string `json:"sheet_name,omitempty"`
+	Cell      string `json:"cell,omitempty"`
+}
+
+// addDiagnostic records a problem on the extraction
+func (e *ExcelExtractor) addDiagnostic(diagnostic Diagnostic) {
+	e.Extraction.Diagnostics = append(e.Extraction.Diagnostics, diagnostic)
+}
+
+// warnf records a warning about a field
+func (e *ExcelExtractor) warnf(code, section, field, sheetName, cell, format string, args ...interface{}) {
+	e.addDiagnostic(Diagnostic{
+		Code:      code,
+		Severity:  SeverityWarning,
+		Message:   fmt.Sprintf(format, args...),
+		Section:   section,
+		Field:     field,
+		SheetName: sheetName,
+		Cell:      cell,
+	})
+}
+
+// errorf records an error about a field
+func (e *ExcelExtractor) errorf(code, section, field, sheetName, cell, format string, args ...interface{}) {
+	e.addDiagnostic(Diagnostic{
+		Code:      code,
+		Severity:  SeverityError,
+		Message:   fmt.Sprintf(format, args...),
+		Section:   section,
+		Field:     field,
+		SheetName: sheetName,
+		Cell:      cell,
+	})
+}
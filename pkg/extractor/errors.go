@@ -1,6 +1,9 @@
 package extractor
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type DivideByZeroError struct {
 	dividend int
@@ -13,3 +16,113 @@ type SheetNotFoundError struct {
 func (e SheetNotFoundError) Error() string {
 	return fmt.Sprintf("Sheet name not found for searchWord: %s", e.searchWord)
 }
+
+// SheetNotExistError is returned when a workbook has no sheet of that name
+type SheetNotExistError struct {
+	sheetName string
+}
+
+func (e SheetNotExistError) Error() string {
+	return fmt.Sprintf("sheet %s does not exist", e.sheetName)
+}
+
+// SectionError holds the error diagnostics of one failed section
+type SectionError struct {
+	Section     string
+	Diagnostics []Diagnostic
+}
+
+func (e SectionError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, diagnostic := range e.Diagnostics {
+		messages[i] = diagnostic.Message
+		if diagnostic.Field != "" {
+			messages[i] = diagnostic.Field + ": " + messages[i]
+		}
+	}
+	return fmt.Sprintf("section %s: %s", e.Section, strings.Join(messages, "; "))
+}
+
+// ExtractionError is returned by ExtractWithError when one or more sections
+// failed. The extraction returned with it holds everything else.
+type ExtractionError struct {
+	Sections []SectionError
+}
+
+func (e *ExtractionError) Error() string {
+	failed := make([]string, len(e.Sections))
+	for i, section := range e.Sections {
+		failed[i] = section.Error()
+	}
+	return fmt.Sprintf("extraction failed for %d section(s): %s", len(e.Sections), strings.Join(failed, " | "))
+}
+
+func (e *ExtractionError) Unwrap() []error {
+	errs := make([]error, len(e.Sections))
+	for i, section := range e.Sections {
+		errs[i] = section
+	}
+	return errs
+}
+
+// newExtractionError groups the error diagnostics by section in template
+// order, nil when no section failed
+func newExtractionError(sections []SectionTemplate, diagnostics []Diagnostic) error {
+	extractionErr := &ExtractionError{}
+	for _, section := range sections {
+		sectionErr := SectionError{Section: section.Name}
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Section == section.Name && diagnostic.Severity == SeverityError {
+				sectionErr.Diagnostics = append(sectionErr.Diagnostics, diagnostic)
+			}
+		}
+		if len(sectionErr.Diagnostics) > 0 {
+			extractionErr.Sections = append(extractionErr.Sections, sectionErr)
+		}
+	}
+
+	if len(extractionErr.Sections) == 0 {
+		return nil
+	}
+	return extractionErr
+}
+
+// PasswordRequiredError is returned when an encrypted workbook is opened
+// without a password
+type PasswordRequiredError struct{}
+
+func (e PasswordRequiredError) Error() string {
+	return "workbook is encrypted, password required"
+}
+
+// WrongPasswordError is returned when none of the given passwords decrypts
+// the workbook
+type WrongPasswordError struct {
+	tried int
+}
+
+func (e WrongPasswordError) Error() string {
+	return fmt.Sprintf("workbook is encrypted, none of the %d password(s) is correct", e.tried)
+}
+
+// CanceledError is returned when the context of an extraction is canceled or
+// its deadline passes. The extraction returned with it holds what was
+// extracted until then.
+type CanceledError struct {
+	// Section is the section being extracted, empty when the workbook was
+	// being opened
+	Section string
+	err     error
+}
+
+func (e CanceledError) Error() string {
+	if e.Section == "" {
+		return fmt.Sprintf("extraction canceled: %v", e.err)
+	}
+	return fmt.Sprintf("extraction canceled in section %s: %v", e.Section, e.err)
+}
+
+// Unwrap returns context.Canceled or context.DeadlineExceeded
+func (e CanceledError) Unwrap() error {
+	return e.err
+}
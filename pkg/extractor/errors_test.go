@@ -0,0 +1,69 @@
+package extractor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExtractWithErrorRecoversFieldPanic(t *testing.T) {
+	template := &FormTemplate{
+		Name: "panic",
+		Sections: []SectionTemplate{{
+			Name:  SectionBuyerDetails,
+			Sheet: "buyer details",
+			Fields: map[string]SearchCriteria{
+				"PartDescription": {
+					SearchTerms: []string{"part description"},
+					CellRanges:  []CellRange{{StartCell: "B13", EndCell: "D13"}},
+					Offset:      3,
+				},
+				// a checkbox read into a string field panics when it is set
+				"PartNumber": {
+					SearchTerms:     []string{"part number"},
+					CellRanges:      []CellRange{{StartCell: "B12", EndCell: "D12"}},
+					BoolCheckBox:    true,
+					BoolClfCriteria: BoolClassificationCriteria{Offset: 3, SearchTerms: []string{"YES"}},
+				},
+				"RFQ": {
+					SearchTerms: []string{"quote reference"},
+					CellRanges:  []CellRange{{StartCell: "B19", EndCell: "D19"}},
+					Offset:      3,
+				},
+			},
+		}},
+	}
+	e := newTestExtractor(t, template, testSheet{
+		name: "Buyer Details",
+		values: map[string]string{
+			"B12": "Part Number", "E12": "X",
+			"B13": "Part Description", "E13": "Bolt",
+			"B19": "Quote reference", "E19": "Q-1",
+		},
+	})
+
+	extraction, err := e.ExtractWithError()
+
+	var extractionErr *ExtractionError
+	if !errors.As(err, &extractionErr) {
+		t.Fatalf("got error %v, want an *ExtractionError", err)
+	}
+	if len(extractionErr.Sections) != 1 || extractionErr.Sections[0].Section != SectionBuyerDetails {
+		t.Fatalf("got failed sections %+v, want only %s", extractionErr.Sections, SectionBuyerDetails)
+	}
+	diagnostics := extractionErr.Sections[0].Diagnostics
+	if len(diagnostics) != 1 || diagnostics[0].Field != "PartNumber" || diagnostics[0].Code != DiagnosticExtractorFailed || !strings.Contains(diagnostics[0].Message, "panic") {
+		t.Errorf("got diagnostics %+v, want one panic of PartNumber", diagnostics)
+	}
+	if !strings.Contains(err.Error(), "PartNumber") {
+		t.Errorf("error %q does not name the failed field", err)
+	}
+
+	// the fields before and after the failing one are still extracted
+	if got := extraction.BuyerDetails.PartDescription; got != "Bolt" {
+		t.Errorf("got part description %q, want %q", got, "Bolt")
+	}
+	if got := extraction.BuyerDetails.RFQ; got != "Q-1" {
+		t.Errorf("got RFQ %q, want %q", got, "Q-1")
+	}
+}
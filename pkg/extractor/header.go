@@ -0,0 +1,135 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adhadse/excelFormExtractor/pkg/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+// HeaderMatch describes the header row picked for a table section
+type HeaderMatch struct {
+	Row      int `json:"row"`       // first row of the header
+	RowSpan  int `json:"row_span"`  // 1, or 2 when the header spans two merged rows
+	Score    int `json:"score"`     // number of column mappings found in the header
+	MaxScore int `json:"max_score"` // number of column mappings searched for
+	texts    []string
+}
+
+// DataRow returns the first row below the header
+func (h *HeaderMatch) DataRow() int {
+	return h.Row + h.RowSpan
+}
+
+// findHeaderRow scans the sheet for the row, or pair of rows, whose cells
+// match the most column mappings. scanRows limits the scan to the first rows
+// of the sheet, 0 scans the whole sheet. The rows are streamed, only the
+// previous row is kept.
+func (e *ExcelExtractor) findHeaderRow(sheetName string, columnMappings []ColumnMapping, scanRows int) (*HeaderMatch, error) {
+	index, err := e.streamMergeIndex(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Best score first, a single row wins over two rows with the same score
+	// and an earlier row over a later one
+	var best *HeaderMatch
+	consider := func(row int, rows ...[]string) {
+		texts := headerTexts(index, row, rows)
+		score := 0
+		for _, mapping := range columnMappings {
+			if _, found := findColumnByHeader(texts, mapping.SearchTerms); found {
+				score++
+			}
+		}
+		if score == 0 || (best != nil && (score < best.Score || (score == best.Score && len(rows) >= best.RowSpan))) {
+			return
+		}
+		best = &HeaderMatch{Row: row, RowSpan: len(rows), Score: score, MaxScore: len(columnMappings), texts: texts}
+	}
+
+	var previous []string
+	lastRow := 0
+	var canceled error
+	err = e.workbook.IterateRows(sheetName, func(row int, values []string) bool {
+		if canceled = e.checkContext(SectionControlledContent); canceled != nil {
+			return false
+		}
+		index.setRowValues(row, values)
+
+		// headers starting at the previous row, now that the row below is known
+		if row > 1 {
+			consider(row-1, previous)
+			consider(row-1, previous, values)
+		}
+		previous, lastRow = values, row
+		return scanRows == 0 || row <= scanRows
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows: %w", err)
+	}
+	if canceled != nil {
+		return nil, canceled
+	}
+	if lastRow > 0 && (scanRows == 0 || lastRow <= scanRows) {
+		consider(lastRow, previous)
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("header row not found")
+	}
+	return best, nil
+}
+
+// headerTexts returns the header text of every column for a header made of
+// rows, the first of them at row. Empty cells inside a merged range take the
+// merged value, and the rows of a two-row header are joined with a space.
+func headerTexts(index *mergeIndex, row int, rows [][]string) []string {
+	width := 0
+	for _, values := range rows {
+		width = max(width, len(values))
+	}
+
+	texts := make([]string, width)
+	for col := 1; col <= width; col++ {
+		var parts []string
+		for i, values := range rows {
+			value := ""
+			if col <= len(values) {
+				value = strings.TrimSpace(values[col-1])
+			}
+			if value == "" {
+				if mergedRange, found := index.find(col, row+i); found {
+					value = mergedRange.Value
+				}
+			}
+			if value != "" && (len(parts) == 0 || parts[len(parts)-1] != value) {
+				parts = append(parts, value)
+			}
+		}
+		texts[col-1] = utils.RemoveExtraSpaces(strings.Join(parts, " "))
+	}
+	return texts
+}
+
+// findColumnByHeader returns the first column whose header text contains one
+// of the search terms
+func findColumnByHeader(headerTexts []string, searchTerms []string) (string, bool) {
+	for colIdx, headerCell := range headerTexts {
+		if headerCell == "" {
+			continue
+		}
+		for _, term := range searchTerms {
+			if matchesSearchTerm(headerCell, term) {
+				// Convert column index to letter (0 = A, 1 = B, etc.)
+				colName, err := excelize.ColumnNumberToName(colIdx + 1)
+				if err != nil {
+					return "", false
+				}
+				return colName, true
+			}
+		}
+	}
+	return "", false
+}
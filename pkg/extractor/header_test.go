@@ -0,0 +1,85 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindHeaderRow(t *testing.T) {
+	columnMappings := []ColumnMapping{
+		{FieldName: "ItemNum", SearchTerms: []string{"Item"}},
+		{FieldName: "PartNumber", SearchTerms: []string{"Part Number"}},
+		{FieldName: "PartDescription", SearchTerms: []string{"Part Description"}},
+	}
+
+	tests := []struct {
+		name      string
+		values    map[string]string
+		merges    []CellRange
+		scanRows  int
+		want      HeaderMatch
+		wantTexts []string
+		wantErr   bool
+	}{
+		{
+			name: "single row",
+			values: map[string]string{
+				"A1": "Controlled content",
+				"A3": "Item", "B3": "Part Number", "C3": "Part Description",
+				"A4": "1", "B4": "P-1", "C4": "Bolt",
+			},
+			want:      HeaderMatch{Row: 3, RowSpan: 1, Score: 3, MaxScore: 3},
+			wantTexts: []string{"item", "part number", "part description"},
+		},
+		{
+			name: "two rows under a merged group title",
+			values: map[string]string{
+				"A1": "Controlled content",
+				"A2": "Item", "B2": "Part",
+				"B3": "Number", "C3": "Description",
+				"A4": "1", "B4": "P-1", "C4": "Bolt",
+			},
+			merges:    []CellRange{{StartCell: "A2", EndCell: "A3"}, {StartCell: "B2", EndCell: "C2"}},
+			want:      HeaderMatch{Row: 2, RowSpan: 2, Score: 3, MaxScore: 3},
+			wantTexts: []string{"item", "part number", "part description"},
+		},
+		{
+			name: "best row past the scanned rows",
+			values: map[string]string{
+				"A2": "Item",
+				"A5": "Item", "B5": "Part Number", "C5": "Part Description",
+			},
+			scanRows:  3,
+			want:      HeaderMatch{Row: 2, RowSpan: 1, Score: 1, MaxScore: 3},
+			wantTexts: []string{"item"},
+		},
+		{
+			name:    "no header",
+			values:  map[string]string{"A1": "Controlled content", "B2": "Bolt"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestExtractor(t, nil, testSheet{name: "Controlled Content", values: test.values, merges: test.merges})
+
+			got, err := e.findHeaderRow("Controlled Content", columnMappings, test.scanRows)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Row != test.want.Row || got.RowSpan != test.want.RowSpan || got.Score != test.want.Score || got.MaxScore != test.want.MaxScore {
+				t.Errorf("got %+v, want %+v", *got, test.want)
+			}
+			if !reflect.DeepEqual(got.texts, test.wantTexts) {
+				t.Errorf("got texts %q, want %q", got.texts, test.wantTexts)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package extractor
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// testSheet is one sheet of a workbook built by a test
+type testSheet struct {
+	name   string
+	values map[string]string // cell values by cell name, e.g. "B12"
+	merges []CellRange
+	// checkboxes and other controls, anchored at their Cell
+	controls []FormControl
+}
+
+// newTestWorkbook builds the sheets as a MemoryWorkbook
+func newTestWorkbook(t *testing.T, sheets ...testSheet) *MemoryWorkbook {
+	t.Helper()
+	w := &MemoryWorkbook{}
+	for _, sheet := range sheets {
+		if err := w.AddSheet(sheet.name); err != nil {
+			t.Fatal(err)
+		}
+		for cell, value := range sheet.values {
+			if err := w.SetCellValue(sheet.name, cell, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, merge := range sheet.merges {
+			if err := w.MergeCells(sheet.name, merge.StartCell, merge.EndCell); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, control := range sheet.controls {
+			if err := w.AddFormControl(sheet.name, control); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return w
+}
+
+// writeTestWorkbook saves the sheets as a workbook in a temporary directory
+// and returns its path
+func writeTestWorkbook(t *testing.T, sheets ...testSheet) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for i, sheet := range sheets {
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sheet.name); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := f.NewSheet(sheet.name); err != nil {
+			t.Fatal(err)
+		}
+		for cell, value := range sheet.values {
+			if err := f.SetCellStr(sheet.name, cell, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, merge := range sheet.merges {
+			if err := f.MergeCell(sheet.name, merge.StartCell, merge.EndCell); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, control := range sheet.controls {
+			var controlType excelize.FormControlType
+			for excelizeType, name := range excelizeFormControlTypes {
+				if name == control.Type {
+					controlType = excelizeType
+				}
+			}
+			err := f.AddFormControl(sheet.name, excelize.FormControl{
+				Cell:    control.Cell,
+				Type:    controlType,
+				Text:    control.Text,
+				Checked: control.Checked,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "workbook.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestExtractor builds the sheets as a MemoryWorkbook and extracts it
+// with the template, the built-in SECCF one when nil. The company name is
+// "Amazon".
+func newTestExtractor(t *testing.T, template *FormTemplate, sheets ...testSheet) *ExcelExtractor {
+	t.Helper()
+	if template == nil {
+		template = DefaultSECCFTemplate()
+	}
+	e, err := MakeTemplateExtractorFromWorkbook(newTestWorkbook(t, sheets...), CompanyNameList{"Amazon"}, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
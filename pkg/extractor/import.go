@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Legacy .xls workbooks are converted into an in-memory OOXML workbook, so
+// their number formats are displayed by excelize like those of .xlsx files.
+
+// importedArea is a block of cells, 0-based
+type importedArea struct {
+	firstRow, lastRow, firstCol, lastCol int
+}
+
+// importedCheckBox is a checkbox anchored at its 0-based top-left cell
+type importedCheckBox struct {
+	row, col int
+	checked  bool
+	text     string
+}
+
+// newImportedFile creates an empty workbook with the given sheets
+func newImportedFile(sheetNames []string) (*excelize.File, error) {
+	if len(sheetNames) == 0 {
+		return nil, fmt.Errorf("workbook has no worksheets")
+	}
+
+	f := excelize.NewFile()
+	for i, name := range sheetNames {
+		var err error
+		if i == 0 {
+			err = f.SetSheetName(f.GetSheetName(0), name)
+		} else {
+			_, err = f.NewSheet(name)
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("sheet %s: %w", name, err)
+		}
+	}
+	return f, nil
+}
+
+// addImportedShapes adds the merged ranges and checkboxes of a sheet whose
+// cells lie in used
+func addImportedShapes(f *excelize.File, sheetName string, used importedArea, merges []importedArea, checkBoxes []importedCheckBox) error {
+	for _, checkBox := range checkBoxes {
+		used.lastRow, used.lastCol = max(used.lastRow, checkBox.row), max(used.lastCol, checkBox.col)
+	}
+
+	for _, merge := range merges {
+		// excelize fills every cell of a merged range, so a range running
+		// past the cells in use is clipped to them
+		merge.firstRow, merge.lastRow = min(merge.firstRow, merge.lastRow), min(max(merge.firstRow, merge.lastRow), used.lastRow)
+		merge.firstCol, merge.lastCol = min(merge.firstCol, merge.lastCol), min(max(merge.firstCol, merge.lastCol), used.lastCol)
+		if merge.firstRow > merge.lastRow || merge.firstCol > merge.lastCol {
+			continue
+		}
+		start, err := excelize.CoordinatesToCellName(merge.firstCol+1, merge.firstRow+1)
+		if err != nil {
+			return err
+		}
+		end, err := excelize.CoordinatesToCellName(merge.lastCol+1, merge.lastRow+1)
+		if err != nil {
+			return err
+		}
+		if start == end {
+			continue
+		}
+		if err := f.MergeCell(sheetName, start, end); err != nil {
+			return err
+		}
+	}
+
+	for _, checkBox := range checkBoxes {
+		cell, err := excelize.CoordinatesToCellName(checkBox.col+1, checkBox.row+1)
+		if err != nil {
+			return err
+		}
+		err = f.AddFormControl(sheetName, excelize.FormControl{
+			Cell:    cell,
+			Type:    excelize.FormControlCheckBox,
+			Text:    checkBox.text,
+			Checked: checkBox.checked,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reopenImportedFile writes the converted workbook and reopens it, so it is
+// read exactly like a .xlsx file
+func reopenImportedFile(f *excelize.File) (*excelize.File, error) {
+	defer f.Close()
+
+	buffer, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return excelize.OpenReader(bytes.NewReader(buffer.Bytes()))
+}
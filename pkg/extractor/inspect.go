@@ -0,0 +1,82 @@
+package extractor
+
+import "github.com/xuri/excelize/v2"
+
+// SheetInfo summarises one sheet of a workbook
+type SheetInfo struct {
+	Name         string `json:"name"`
+	Dimension    string `json:"dimension"`
+	Rows         int    `json:"rows"`
+	MergedRanges int    `json:"merged_ranges"`
+	FormControls int    `json:"form_controls"`
+	CheckBoxes   int    `json:"checkboxes"`
+}
+
+// SectionSheet tells which sheet a template section is read from
+type SectionSheet struct {
+	Section   string `json:"section"`
+	Sheet     string `json:"sheet"`                // word searched for in the sheet names
+	SheetName string `json:"sheet_name,omitempty"` // empty when no sheet matched
+}
+
+// WorkbookInfo describes a workbook as the extractor sees it
+type WorkbookInfo struct {
+	Template string         `json:"template"`
+	Sheets   []SheetInfo    `json:"sheets"`
+	Sections []SectionSheet `json:"sections"`
+}
+
+// Inspect lists the sheets of the workbook with their merged ranges and form
+// controls, and the sheet every template section would be read from
+func (e *ExcelExtractor) Inspect() (WorkbookInfo, error) {
+	info := WorkbookInfo{Template: e.template.Name}
+
+	for _, sheetName := range e.workbook.SheetNames() {
+		sheet := SheetInfo{Name: sheetName}
+
+		rows, err := e.getSheetRows(sheetName)
+		if err != nil {
+			return info, err
+		}
+		sheet.Rows = len(rows)
+		sheet.Dimension = rowsDimension(rows)
+
+		mergeIndex, err := e.getMergeIndex(sheetName)
+		if err != nil {
+			return info, err
+		}
+		sheet.MergedRanges = len(mergeIndex.ranges)
+
+		controls, err := e.getFormControls(sheetName)
+		if err != nil {
+			return info, err
+		}
+		sheet.FormControls = len(controls)
+		for _, control := range controls {
+			if control.Type == FormControlCheckBox {
+				sheet.CheckBoxes++
+			}
+		}
+
+		info.Sheets = append(info.Sheets, sheet)
+	}
+
+	for _, section := range e.template.Sections {
+		_, sheetName, _ := e.searchSheetName(section.Sheet)
+		info.Sections = append(info.Sections, SectionSheet{Section: section.Name, Sheet: section.Sheet, SheetName: sheetName})
+	}
+	return info, nil
+}
+
+// rowsDimension returns the range used by the rows, e.g. "A1:F40"
+func rowsDimension(rows [][]string) string {
+	lastCol := 0
+	for _, row := range rows {
+		lastCol = max(lastCol, len(row))
+	}
+	if lastCol == 0 {
+		return "A1"
+	}
+	end, _ := excelize.CoordinatesToCellName(lastCol, len(rows))
+	return "A1:" + end
+}
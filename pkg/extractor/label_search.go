@@ -0,0 +1,69 @@
+package extractor
+
+import (
+	"strings"
+
+	"github.com/adhadse/excelFormExtractor/pkg/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+// matchesSearchTerm reports whether a label cell value contains the search term,
+// ignoring case and repeated whitespace
+func matchesSearchTerm(value string, searchTerm string) bool {
+	return strings.Contains(utils.RemoveExtraSpaces(value), utils.RemoveExtraSpaces(searchTerm))
+}
+
+// getSheetRows returns all rows of a sheet
+func (e *ExcelExtractor) getSheetRows(sheetName string) ([][]string, error) {
+	snapshot, err := e.getSnapshot(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.rows, nil
+}
+
+// findLabelCell scans the sheet, or only searchRegion when given, for a cell
+// matching one of the search terms. A cell equal to a search term wins over
+// the first cell merely containing one.
+func (e *ExcelExtractor) findLabelCell(sheetName string, searchTerms []string, searchRegion *CellRange) (string, bool, error) {
+	rows, err := e.getSheetRows(sheetName)
+	if err != nil {
+		return "", false, err
+	}
+
+	var bounds *region
+	if searchRegion != nil {
+		r, err := parseRegion(*searchRegion)
+		if err != nil {
+			return "", false, err
+		}
+		bounds = &r
+	}
+
+	firstMatch := ""
+	for rowIdx, row := range rows {
+		for colIdx, value := range row {
+			if value == "" || (bounds != nil && !bounds.contains(colIdx+1, rowIdx+1)) {
+				continue
+			}
+
+			for _, searchTerm := range searchTerms {
+				if !matchesSearchTerm(value, searchTerm) {
+					continue
+				}
+
+				cell, err := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+				if err != nil {
+					return "", false, err
+				}
+				if utils.RemoveExtraSpaces(value) == utils.RemoveExtraSpaces(searchTerm) {
+					return cell, true, nil
+				}
+				if firstMatch == "" {
+					firstMatch = cell
+				}
+			}
+		}
+	}
+	return firstMatch, firstMatch != "", nil
+}
@@ -0,0 +1,88 @@
+package extractor
+
+import "testing"
+
+// partNumberTemplate returns a template reading the part number with the
+// given criteria, its label expected at B12
+func partNumberTemplate(criteria SearchCriteria) *FormTemplate {
+	criteria.SearchTerms = []string{"part number"}
+	criteria.CellRanges = []CellRange{{StartCell: "B12", EndCell: "D12"}}
+	return &FormTemplate{
+		Name: "part_number",
+		Sections: []SectionTemplate{{
+			Name:   SectionBuyerDetails,
+			Sheet:  "buyer details",
+			Fields: map[string]SearchCriteria{"PartNumber": criteria},
+		}},
+	}
+}
+
+func TestLabelSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria SearchCriteria
+		values   map[string]string
+		want     string
+	}{
+		{
+			name:     "label at its cell range",
+			criteria: SearchCriteria{Offset: 3, LabelSearch: true},
+			values:   map[string]string{"B12": "Part Number", "E12": "PN-1"},
+			want:     "PN-1",
+		},
+		{
+			name:     "label moved down by inserted rows",
+			criteria: SearchCriteria{Offset: 3, LabelSearch: true},
+			values:   map[string]string{"B15": "Part Number", "E15": "PN-1"},
+			want:     "PN-1",
+		},
+		{
+			name:     "moved label without label search",
+			criteria: SearchCriteria{Offset: 3},
+			values:   map[string]string{"B15": "Part Number", "E15": "PN-1"},
+		},
+		{
+			name:     "moved label inside the search region",
+			criteria: SearchCriteria{Offset: 3, LabelSearch: true, SearchRegion: &CellRange{StartCell: "A10", EndCell: "F20"}},
+			values:   map[string]string{"B15": "Part Number", "E15": "PN-1"},
+			want:     "PN-1",
+		},
+		{
+			name:     "moved label outside the search region",
+			criteria: SearchCriteria{Offset: 3, LabelSearch: true, SearchRegion: &CellRange{StartCell: "A10", EndCell: "F14"}},
+			values:   map[string]string{"B15": "Part Number", "E15": "PN-1"},
+		},
+		{
+			name:     "cell equal to the label wins over one containing it",
+			criteria: SearchCriteria{Offset: 3, LabelSearch: true},
+			values:   map[string]string{"B3": "Part number of the supplier", "E3": "SPN-1", "B15": "Part Number", "E15": "PN-1"},
+			want:     "PN-1",
+		},
+		{
+			name:     "value below and right of its label",
+			criteria: SearchCriteria{Offset: 1, RowOffset: 1, LabelSearch: true},
+			values:   map[string]string{"B12": "Part Number", "C12": "PN-0", "C13": "PN-1"},
+			want:     "PN-1",
+		},
+		{
+			name:     "value below and right of a moved label",
+			criteria: SearchCriteria{Offset: 1, RowOffset: 1, LabelSearch: true},
+			values:   map[string]string{"Z30": "Part Number", "AA31": "PN-1"},
+			want:     "PN-1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestExtractor(t, partNumberTemplate(test.criteria), testSheet{name: "Buyer Details", values: test.values})
+
+			extraction := e.Extract()
+			if extraction.BuyerDetails == nil {
+				t.Fatal("buyer details not extracted")
+			}
+			if got := extraction.BuyerDetails.PartNumber; got != test.want {
+				t.Errorf("got part number %q, want %q", got, test.want)
+			}
+		})
+	}
+}
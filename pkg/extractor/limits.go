@@ -0,0 +1,193 @@
+package extractor
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Names of the limits, reported by LimitExceededError
+const (
+	LimitFileSize  = "file_size"
+	LimitUnzipSize = "unzip_size"
+	LimitSheets    = "sheets"
+	LimitRows      = "rows"
+	LimitPictures  = "pictures"
+	LimitCells     = "cells"
+)
+
+// Limits guard against zip bombs and oversized workbooks, e.g. uploads from
+// the internet. A zero field means no limit.
+type Limits struct {
+	// MaxFileSize is the size of the workbook file in bytes
+	MaxFileSize int64
+	// UnzipSizeLimit is the size of the unzipped package in bytes
+	UnzipSizeLimit int64
+	// UnzipXMLSizeLimit is the size in bytes up to which a worksheet or the
+	// shared strings are unzipped in memory, larger ones go to temporary
+	// files. It cannot be larger than UnzipSizeLimit.
+	UnzipXMLSizeLimit int64
+	// MaxSheets is the number of sheets of the workbook
+	MaxSheets int
+	// MaxRows is the number of rows read from one sheet
+	MaxRows int
+	// MaxPictures is the number of pictures of the workbook
+	MaxPictures int
+	// MaxCells is the number of non-empty cells of a .xls or .ods workbook,
+	// which are read into memory at once. Repeated rows and columns count
+	// every repetition.
+	MaxCells int
+}
+
+// DefaultLimits returns limits fitting supplier forms, generous enough for
+// tables of tens of thousands of rows
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFileSize:       32 << 20,
+		UnzipSizeLimit:    512 << 20,
+		UnzipXMLSizeLimit: 16 << 20,
+		MaxSheets:         64,
+		MaxRows:           200000,
+		MaxPictures:       500,
+		MaxCells:          2000000,
+	}
+}
+
+// LimitExceededError is returned when a workbook exceeds one of its Limits
+type LimitExceededError struct {
+	Limit     string // one of the Limit* names
+	Max       int64
+	SheetName string // sheet of the rows limit
+}
+
+func (e LimitExceededError) Error() string {
+	if e.SheetName != "" {
+		return fmt.Sprintf("sheet %s exceeds the %s limit of %d", e.SheetName, e.Limit, e.Max)
+	}
+	return fmt.Sprintf("workbook exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// checkLimit returns a LimitExceededError when value is over a limit other
+// than 0
+func checkLimit(limit string, value int64, max int64) error {
+	if max > 0 && value > max {
+		return LimitExceededError{Limit: limit, Max: max}
+	}
+	return nil
+}
+
+// readLimited reads a workbook from r, at most MaxFileSize bytes of it
+func (l Limits) readLimited(r io.Reader) ([]byte, error) {
+	if l.MaxFileSize <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, l.MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return data, checkLimit(LimitFileSize, int64(len(data)), l.MaxFileSize)
+}
+
+// excelizeOptions passes the unzip limits to excelize. The unzipped size is
+// checked by checkPackage first, excelize has no error value to tell it.
+func (l Limits) excelizeOptions() excelize.Options {
+	return excelize.Options{
+		UnzipSizeLimit:    l.UnzipSizeLimit,
+		UnzipXMLSizeLimit: l.UnzipXMLSizeLimit,
+	}
+}
+
+// checkPackage checks the unzipped size and the pictures of a zip package
+// before anything is unzipped. The sizes are the ones declared by the
+// package, archive/zip fails on entries growing past them.
+func (l Limits) checkPackage(pkg *zip.Reader) error {
+	var unzipSize int64
+	pictures := 0
+	for _, file := range pkg.File {
+		unzipSize += int64(file.UncompressedSize64)
+		if isPicturePart(file.Name) {
+			pictures++
+		}
+	}
+	if err := checkLimit(LimitUnzipSize, unzipSize, l.UnzipSizeLimit); err != nil {
+		return err
+	}
+	return checkLimit(LimitPictures, int64(pictures), int64(l.MaxPictures))
+}
+
+// checkRows returns a LimitExceededError when a sheet has values in rows
+// past MaxRows
+func (l Limits) checkRows(sheetName string, lastRow int) error {
+	if l.MaxRows > 0 && lastRow > l.MaxRows {
+		return LimitExceededError{Limit: LimitRows, Max: int64(l.MaxRows), SheetName: sheetName}
+	}
+	return nil
+}
+
+// isPicturePart tells the media of OOXML workbooks and the pictures of
+// OpenDocument spreadsheets
+func isPicturePart(name string) bool {
+	name = strings.ToLower(name)
+	return (strings.HasPrefix(name, "xl/media/") || strings.HasPrefix(name, "pictures/")) && !strings.HasSuffix(name, "/")
+}
+
+// checkWorkbook checks the limits known once a workbook is open
+func (l Limits) checkWorkbook(workbook Workbook) error {
+	if err := checkLimit(LimitSheets, int64(len(workbook.SheetNames())), int64(l.MaxSheets)); err != nil {
+		return err
+	}
+
+	// the pictures of converted workbooks, the others were counted in their
+	// package
+	if w, ok := workbook.(*excelizeWorkbook); ok && w.data == nil {
+		pictures := 0
+		w.file.Pkg.Range(func(name, _ any) bool {
+			if isPicturePart(name.(string)) {
+				pictures++
+			}
+			return true
+		})
+		return checkLimit(LimitPictures, int64(pictures), int64(l.MaxPictures))
+	}
+	return nil
+}
+
+// limitedWorkbook stops reading a sheet past the rows limit
+type limitedWorkbook struct {
+	Workbook
+	maxRows int
+}
+
+func (w *limitedWorkbook) IterateRows(sheetName string, fn func(row int, values []string) bool) error {
+	var exceeded error
+	err := w.Workbook.IterateRows(sheetName, func(row int, values []string) bool {
+		if row > w.maxRows {
+			exceeded = LimitExceededError{Limit: LimitRows, Max: int64(w.maxRows), SheetName: sheetName}
+			return false
+		}
+		return fn(row, values)
+	})
+	if err != nil {
+		return err
+	}
+	return exceeded
+}
+
+// Rows reads the sheet row by row, so a sheet over the limit is never held
+// in memory
+func (w *limitedWorkbook) Rows(sheetName string) ([][]string, error) {
+	return collectRows(w, sheetName)
+}
+
+// recordLimit keeps the first limit a sheet ran into, ExtractContext returns
+// it
+func (e *ExcelExtractor) recordLimit(err error) {
+	var limitErr LimitExceededError
+	if e.limitErr == nil && errors.As(err, &limitErr) {
+		e.limitErr = limitErr
+	}
+}
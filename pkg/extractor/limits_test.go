@@ -0,0 +1,116 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// pictureWorkbook returns an .xlsx workbook with a different picture in
+// each of the given cells, as excelize stores the same picture once
+func pictureWorkbook(t *testing.T, cells ...string) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for i, cell := range cells {
+		var picture bytes.Buffer
+		if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, i+1, i+1))); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddPictureFromBytes("Sheet1", cell, &excelize.Picture{Extension: ".png", File: picture.Bytes()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenWorkbookLimits(t *testing.T) {
+	threeSheets, err := os.ReadFile(writeTestWorkbook(t,
+		testSheet{name: "Buyer Details", values: map[string]string{"B12": "Part Number"}},
+		testSheet{name: "Product Details"},
+		testSheet{name: "Controlled Content"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoPictures := pictureWorkbook(t, "B2", "D4")
+	encrypted, err := excelize.Encrypt(twoPictures, &excelize.Options{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		passwords []string
+		limits    Limits
+		want      string // limit exceeded, empty when the workbook opens
+	}{
+		{name: "within the default limits", data: threeSheets, limits: DefaultLimits()},
+		{name: "file size", data: threeSheets, limits: Limits{MaxFileSize: int64(len(threeSheets) - 1)}, want: LimitFileSize},
+		{name: "unzip size", data: threeSheets, limits: Limits{UnzipSizeLimit: 1000}, want: LimitUnzipSize},
+		{name: "sheets", data: threeSheets, limits: Limits{MaxSheets: 2}, want: LimitSheets},
+		{name: "pictures", data: twoPictures, limits: Limits{MaxPictures: 1}, want: LimitPictures},
+		{name: "pictures within the limit", data: twoPictures, limits: Limits{MaxPictures: 2}},
+		{name: "encrypted within the default limits", data: encrypted, passwords: []string{"secret"}, limits: DefaultLimits()},
+		{name: "encrypted unzip size", data: encrypted, passwords: []string{"secret"}, limits: Limits{UnzipSizeLimit: 1000}, want: LimitUnzipSize},
+		{name: "encrypted pictures", data: encrypted, passwords: []string{"secret"}, limits: Limits{MaxPictures: 1}, want: LimitPictures},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workbook, err := openWorkbook(test.data, &OpenOptions{Passwords: test.passwords, Limits: test.limits})
+			if err == nil {
+				workbook.Close()
+			}
+			var limitErr LimitExceededError
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case test.want != "" && (!errors.As(err, &limitErr) || limitErr.Limit != test.want):
+				t.Errorf("got %v, want the %s limit", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractRowsLimit(t *testing.T) {
+	values := map[string]string{"A3": "Item", "B3": "Part Number"}
+	for row := 4; row <= 13; row++ {
+		values[fmt.Sprintf("A%d", row)] = fmt.Sprint(row - 3)
+		values[fmt.Sprintf("B%d", row)] = fmt.Sprintf("P-%d", row-3)
+	}
+	data, err := os.ReadFile(writeTestWorkbook(t,
+		testSheet{name: "Buyer Details", values: map[string]string{"B12": "Part Number", "E12": "PN-1"}},
+		testSheet{name: "Product Details"},
+		testSheet{name: "Controlled Content", values: values},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := MakeTemplateExtractorFromBytesWithOptions(data, CompanyNameList{"Amazon"}, DefaultSECCFTemplate(), &OpenOptions{Limits: Limits{MaxRows: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	extraction, err := e.ExtractWithError()
+	var limitErr LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Limit != LimitRows || limitErr.SheetName != "Controlled Content" {
+		t.Fatalf("got %v, want the rows limit of sheet Controlled Content", err)
+	}
+	// the sheets within the limit are still extracted
+	if extraction.BuyerDetails == nil || extraction.BuyerDetails.PartNumber != "PN-1" {
+		t.Errorf("got buyer details %+v, want part number PN-1", extraction.BuyerDetails)
+	}
+}
@@ -0,0 +1,264 @@
+package extractor
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sizes of the columns and rows of a MemoryWorkbook without their own, the
+// defaults of Excel
+const (
+	defaultColumnWidth = 9.140625
+	defaultRowHeight   = 15.0
+)
+
+// MemoryWorkbook is a Workbook built in memory, for workbooks converted from
+// other formats and for tests
+type MemoryWorkbook struct {
+	sheets []*memorySheet
+}
+
+type memorySheet struct {
+	name         string
+	cells        map[[2]int]string // values by 1-based column and row
+	mergedRanges []MergedRange
+	formControls []FormControl
+	pictureCells []string
+	columnWidths map[int]float64
+	rowHeights   map[int]float64
+}
+
+// NewMemoryWorkbook returns a workbook with the given sheets
+func NewMemoryWorkbook(sheetNames ...string) (*MemoryWorkbook, error) {
+	w := &MemoryWorkbook{}
+	for _, sheetName := range sheetNames {
+		if err := w.AddSheet(sheetName); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// AddSheet appends an empty sheet
+func (w *MemoryWorkbook) AddSheet(sheetName string) error {
+	if sheetName == "" {
+		return fmt.Errorf("sheet name is required")
+	}
+	if findSheet(w.SheetNames(), sheetName) >= 0 {
+		return fmt.Errorf("sheet %s already exists", sheetName)
+	}
+	w.sheets = append(w.sheets, &memorySheet{
+		name:         sheetName,
+		cells:        map[[2]int]string{},
+		columnWidths: map[int]float64{},
+		rowHeights:   map[int]float64{},
+	})
+	return nil
+}
+
+func (w *MemoryWorkbook) sheet(sheetName string) (*memorySheet, error) {
+	i := findSheet(w.SheetNames(), sheetName)
+	if i < 0 {
+		return nil, SheetNotExistError{sheetName: sheetName}
+	}
+	return w.sheets[i], nil
+}
+
+// SetCellValue sets the displayed value of a cell
+func (w *MemoryWorkbook) SetCellValue(sheetName string, cell string, value string) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		delete(sheet.cells, [2]int{col, row})
+		return nil
+	}
+	sheet.cells[[2]int{col, row}] = value
+	return nil
+}
+
+// MergeCells merges the block from startCell to endCell, its value is the
+// one of the top-left cell
+func (w *MemoryWorkbook) MergeCells(sheetName string, startCell string, endCell string) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	area, err := parseRegion(CellRange{StartCell: startCell, EndCell: endCell})
+	if err != nil {
+		return err
+	}
+	// stored normalised, top-left to bottom-right
+	startCell, _ = excelize.CoordinatesToCellName(area.startCol, area.startRow)
+	endCell, _ = excelize.CoordinatesToCellName(area.endCol, area.endRow)
+	sheet.mergedRanges = append(sheet.mergedRanges, MergedRange{StartCell: startCell, EndCell: endCell})
+	return nil
+}
+
+// AddFormControl adds a form control anchored at control.Cell
+func (w *MemoryWorkbook) AddFormControl(sheetName string, control FormControl) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	if _, _, err := excelize.CellNameToCoordinates(control.Cell); err != nil {
+		return err
+	}
+	sheet.formControls = append(sheet.formControls, control)
+	return nil
+}
+
+// AddPicture records a picture anchored at cell
+func (w *MemoryWorkbook) AddPicture(sheetName string, cell string) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	if _, _, err := excelize.CellNameToCoordinates(cell); err != nil {
+		return err
+	}
+	sheet.pictureCells = append(sheet.pictureCells, cell)
+	return nil
+}
+
+// SetColumnWidth sets the width of a 1-based column in characters
+func (w *MemoryWorkbook) SetColumnWidth(sheetName string, col int, width float64) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	if col < 1 || col > excelize.MaxColumns {
+		return excelize.ErrColumnNumber
+	}
+	sheet.columnWidths[col] = width
+	return nil
+}
+
+// SetRowHeight sets the height of a 1-based row in points
+func (w *MemoryWorkbook) SetRowHeight(sheetName string, row int, height float64) error {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return err
+	}
+	if row < 1 || row > excelize.TotalRows {
+		return excelize.ErrMaxRows
+	}
+	sheet.rowHeights[row] = height
+	return nil
+}
+
+func (w *MemoryWorkbook) SheetNames() []string {
+	sheetNames := make([]string, len(w.sheets))
+	for i, sheet := range w.sheets {
+		sheetNames[i] = sheet.name
+	}
+	return sheetNames
+}
+
+func (w *MemoryWorkbook) CellValue(sheetName string, cell string) (string, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return "", err
+	}
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return "", err
+	}
+	return sheet.cells[[2]int{col, row}], nil
+}
+
+func (w *MemoryWorkbook) Rows(sheetName string) ([][]string, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	lastCol := map[int]int{}
+	lastRow := 0
+	for position := range sheet.cells {
+		col, row := position[0], position[1]
+		lastCol[row] = max(lastCol[row], col)
+		lastRow = max(lastRow, row)
+	}
+
+	rows := make([][]string, lastRow)
+	for row := 1; row <= lastRow; row++ {
+		values := make([]string, lastCol[row])
+		for col := range values {
+			values[col] = sheet.cells[[2]int{col + 1, row}]
+		}
+		rows[row-1] = values
+	}
+	return rows, nil
+}
+
+func (w *MemoryWorkbook) IterateRows(sheetName string, fn func(row int, values []string) bool) error {
+	rows, err := w.Rows(sheetName)
+	if err != nil {
+		return err
+	}
+	for i, values := range rows {
+		if !fn(i+1, values) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (w *MemoryWorkbook) MergedRanges(sheetName string) ([]MergedRange, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]MergedRange(nil), sheet.mergedRanges...), nil
+}
+
+func (w *MemoryWorkbook) ColumnWidth(sheetName string, col int) (float64, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return 0, err
+	}
+	if width, ok := sheet.columnWidths[col]; ok {
+		return width, nil
+	}
+	return defaultColumnWidth, nil
+}
+
+func (w *MemoryWorkbook) RowHeight(sheetName string, row int) (float64, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return 0, err
+	}
+	if height, ok := sheet.rowHeights[row]; ok {
+		return height, nil
+	}
+	return defaultRowHeight, nil
+}
+
+func (w *MemoryWorkbook) FormControls(sheetName string) ([]FormControl, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return append([]FormControl(nil), sheet.formControls...), nil
+}
+
+func (w *MemoryWorkbook) PictureCells(sheetName string) ([]string, error) {
+	sheet, err := w.sheet(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), sheet.pictureCells...), nil
+}
+
+// Close releases nothing, a MemoryWorkbook holds no files
+func (w *MemoryWorkbook) Close() error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryWorkbookRows(t *testing.T) {
+	w := newTestWorkbook(t, testSheet{
+		name:   "Sheet1",
+		values: map[string]string{"A1": "a", "C2": "c", "B4": "b"},
+		merges: []CellRange{{StartCell: "A5", EndCell: "B6"}},
+	})
+
+	rows, err := w.Rows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"a"}, {"", "", "c"}, nil, {"", "b"}}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows %q, want %q", len(rows), rows, want)
+	}
+	for i := range want {
+		if len(rows[i]) != len(want[i]) || (len(want[i]) > 0 && !reflect.DeepEqual(rows[i], want[i])) {
+			t.Errorf("row %d = %q, want %q", i+1, rows[i], want[i])
+		}
+	}
+
+	merges, err := w.MergedRanges("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merges) != 1 || merges[0].StartCell != "A5" || merges[0].EndCell != "B6" {
+		t.Errorf("got merged ranges %+v, want A5:B6", merges)
+	}
+}
@@ -0,0 +1,122 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// MergedRange is a block of merged cells. Value is the value of the top-left
+// cell, which Excel displays across the whole block.
+type MergedRange struct {
+	StartCell string `json:"start_cell"`
+	EndCell   string `json:"end_cell"`
+	Value     string `json:"value"`
+	area      region
+}
+
+// Contains reports whether cell lies inside the merged block
+func (m *MergedRange) Contains(cell string) bool {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return false
+	}
+	return m.area.contains(col, row)
+}
+
+// mergeIndex holds the merged ranges of one sheet bucketed by row, so a
+// lookup only checks the ranges crossing the row of the cell
+type mergeIndex struct {
+	ranges     []MergedRange
+	byRow      map[int][]int
+	byStartRow map[int][]int
+}
+
+func newMergeIndex(mergedRanges []MergedRange) (*mergeIndex, error) {
+	index := &mergeIndex{byRow: map[int][]int{}, byStartRow: map[int][]int{}}
+	for _, mergedRange := range mergedRanges {
+		area, err := parseRegion(CellRange{StartCell: mergedRange.StartCell, EndCell: mergedRange.EndCell})
+		if err != nil {
+			return nil, fmt.Errorf("invalid merged range: %w", err)
+		}
+
+		mergedRange.area = area
+		index.ranges = append(index.ranges, mergedRange)
+		for row := area.startRow; row <= area.endRow; row++ {
+			index.byRow[row] = append(index.byRow[row], len(index.ranges)-1)
+		}
+		index.byStartRow[area.startRow] = append(index.byStartRow[area.startRow], len(index.ranges)-1)
+	}
+	return index, nil
+}
+
+// setRowValues gives the merged ranges starting on a row the value of their
+// top-left cell
+func (m *mergeIndex) setRowValues(row int, values []string) {
+	for _, i := range m.byStartRow[row] {
+		m.ranges[i].Value = strings.TrimSpace(rowValue(values, m.ranges[i].area.startCol-1))
+	}
+}
+
+// clone returns a copy whose values can be set without touching m, which
+// may be read by other sections at the same time
+func (m *mergeIndex) clone() *mergeIndex {
+	return &mergeIndex{
+		ranges:     append([]MergedRange(nil), m.ranges...),
+		byRow:      m.byRow,
+		byStartRow: m.byStartRow,
+	}
+}
+
+// find returns the merged range containing the cell at col/row
+func (m *mergeIndex) find(col int, row int) (MergedRange, bool) {
+	for _, i := range m.byRow[row] {
+		if m.ranges[i].area.contains(col, row) {
+			return m.ranges[i], true
+		}
+	}
+	return MergedRange{}, false
+}
+
+// getMergeIndex returns the merged ranges of a sheet
+func (e *ExcelExtractor) getMergeIndex(sheetName string) (*mergeIndex, error) {
+	snapshot, err := e.getSnapshot(sheetName)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.merges, nil
+}
+
+// streamMergeIndex returns the merged ranges of a sheet that is streamed,
+// reusing its snapshot when the sheet was already loaded
+func (e *ExcelExtractor) streamMergeIndex(sheetName string) (*mergeIndex, error) {
+	if e.sheets.loaded(sheetName) {
+		if snapshot, err := e.getSnapshot(sheetName); err == nil {
+			return snapshot.merges.clone(), nil
+		}
+	}
+
+	mergedRanges, err := e.workbook.MergedRanges(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged cells: %w", err)
+	}
+	return newMergeIndex(mergedRanges)
+}
+
+// GetMergedRange returns the merged block the cell belongs to. The boolean is
+// false when the cell is not merged.
+func (e *ExcelExtractor) GetMergedRange(sheetName string, cell string) (MergedRange, bool, error) {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return MergedRange{}, false, fmt.Errorf("invalid cell reference %q: %w", cell, err)
+	}
+
+	index, err := e.getMergeIndex(sheetName)
+	if err != nil {
+		return MergedRange{}, false, err
+	}
+
+	mergedRange, found := index.find(col, row)
+	return mergedRange, found, nil
+}
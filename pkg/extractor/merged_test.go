@@ -0,0 +1,61 @@
+package extractor
+
+import "testing"
+
+func TestGetMergedRange(t *testing.T) {
+	e := newTestExtractor(t, nil, testSheet{
+		name:   "Sheet1",
+		values: map[string]string{"B12": "Buyer", "A1": "Title"},
+		merges: []CellRange{{StartCell: "B12", EndCell: "D12"}, {StartCell: "A1", EndCell: "A3"}, {StartCell: "AA5", EndCell: "AC6"}},
+	})
+
+	tests := []struct {
+		cell      string
+		wantFound bool
+		wantStart string
+		wantValue string
+	}{
+		{cell: "B12", wantFound: true, wantStart: "B12", wantValue: "Buyer"},
+		{cell: "D12", wantFound: true, wantStart: "B12", wantValue: "Buyer"},
+		{cell: "B1"},
+		{cell: "B11"},
+		{cell: "B13"},
+		{cell: "E12"},
+		{cell: "A12"},
+		{cell: "A2", wantFound: true, wantStart: "A1", wantValue: "Title"},
+		{cell: "A4"},
+		{cell: "AB6", wantFound: true, wantStart: "AA5"},
+		{cell: "B5"},
+	}
+	for _, test := range tests {
+		got, found, err := e.GetMergedRange("Sheet1", test.cell)
+		if err != nil {
+			t.Fatalf("%s: %v", test.cell, err)
+		}
+		if found != test.wantFound || got.StartCell != test.wantStart || got.Value != test.wantValue {
+			t.Errorf("%s: got %v %s %q, want %v %s %q", test.cell, found, got.StartCell, got.Value, test.wantFound, test.wantStart, test.wantValue)
+		}
+	}
+
+	if _, _, err := e.GetMergedRange("Sheet1", "12B"); err == nil {
+		t.Error("invalid cell reference: got no error")
+	}
+}
+
+func TestGetCellValueMerged(t *testing.T) {
+	e := newTestExtractor(t, nil, testSheet{
+		name:   "Sheet1",
+		values: map[string]string{"B12": " Buyer ", "B1": ""},
+		merges: []CellRange{{StartCell: "B12", EndCell: "D13"}},
+	})
+
+	for cell, want := range map[string]string{"B12": "Buyer", "C13": "Buyer", "D12": "Buyer", "B1": "", "E12": ""} {
+		got, err := e.GetCellValue(CellRange{StartCell: cell, EndCell: cell}, "Sheet1")
+		if err != nil {
+			t.Fatalf("%s: %v", cell, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", cell, got, want)
+		}
+	}
+}
@@ -0,0 +1,669 @@
+package extractor
+
+// OpenDocument spreadsheets (.ods, LibreOffice Calc) are read from the
+// content.xml of their zip package into a MemoryWorkbook with the displayed
+// text of their cells, merged ranges, sheet names, images and checkboxes with
+// their labels, states and linked cells.
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const odsMimetype = "application/vnd.oasis.opendocument.spreadsheet"
+
+// XML namespaces of the elements read from content.xml
+const (
+	odsOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsStyleNS  = "urn:oasis:names:tc:opendocument:xmlns:style:1.0"
+	odsTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsTextNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+	odsDrawNS   = "urn:oasis:names:tc:opendocument:xmlns:drawing:1.0"
+	odsFormNS   = "urn:oasis:names:tc:opendocument:xmlns:form:1.0"
+	odsSVGNS    = "urn:oasis:names:tc:opendocument:xmlns:svg-compatible:1.0"
+	odsXLinkNS  = "http://www.w3.org/1999/xlink"
+	odsXMLNS    = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Default LibreOffice column width and row height in points, used to place
+// shapes positioned on the sheet rather than in a cell
+const (
+	odsDefaultColumnWidth = 64.0 // 2.258cm
+	odsDefaultRowHeight   = 12.8 // 0.452cm
+)
+
+// odsSpan is a run of columns or rows of the same size in points
+type odsSpan struct {
+	count int
+	size  float64
+}
+
+type odsCell struct {
+	row, col int
+	text     string
+}
+
+// odsShape is a control or image, placed in a cell or, when row is -1, at
+// a position on the sheet
+type odsShape struct {
+	row, col int
+	x, y     float64 // points from the top-left corner of the sheet
+	control  string  // id of the form control
+	image    string  // path of the image in the package
+}
+
+type odsCheckBox struct {
+	label      string
+	checked    bool
+	linkedCell string // e.g. "$'Buyer Details'.$B$4"
+}
+
+type odsSheet struct {
+	name    string
+	cells   []odsCell
+	merges  []importedArea
+	shapes  []odsShape
+	columns []odsSpan
+	rows    []odsSpan
+	rowNum  int // rows read so far
+}
+
+type odsDocument struct {
+	sheets       []*odsSheet
+	checkBoxes   map[string]odsCheckBox // by control id
+	columnWidths map[string]float64     // by style name
+	rowHeights   map[string]float64     // by style name
+	limits       Limits
+	cellCount    int // cells read so far, repetitions included
+}
+
+// isODSPackage tells an OpenDocument spreadsheet by its mimetype entry
+func isODSPackage(pkg *zip.Reader) bool {
+	mimetype, err := readZipEntry(pkg, "mimetype")
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(mimetype)) == odsMimetype
+}
+
+func readZipEntry(pkg *zip.Reader, name string) ([]byte, error) {
+	entry, err := pkg.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+	return io.ReadAll(entry)
+}
+
+// openODS reads the spreadsheet of an OpenDocument package. The sheets,
+// rows and cells limits are checked while parsing, before repeated rows and
+// columns are expanded.
+func openODS(pkg *zip.Reader, limits Limits) (Workbook, error) {
+	// encrypted packages keep content.xml encrypted, which is not supported
+	if manifest, err := readZipEntry(pkg, "META-INF/manifest.xml"); err == nil && bytes.Contains(manifest, []byte("encryption-data")) {
+		return nil, fmt.Errorf("encrypted OpenDocument spreadsheets are not supported")
+	}
+
+	content, err := pkg.Open("content.xml")
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenDocument spreadsheet: %w", err)
+	}
+	defer content.Close()
+
+	doc, err := parseODSContent(content, limits)
+	if _, ok := err.(LimitExceededError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenDocument spreadsheet: %w", err)
+	}
+	return doc.toWorkbook()
+}
+
+func parseODSContent(r io.Reader, limits Limits) (*odsDocument, error) {
+	doc := &odsDocument{
+		checkBoxes:   map[string]odsCheckBox{},
+		columnWidths: map[string]float64{},
+		rowHeights:   map[string]float64{},
+		limits:       limits,
+	}
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case isODSElement(start, odsStyleNS, "style"):
+			err = doc.parseStyle(decoder, start)
+		case isODSElement(start, odsTableNS, "table"):
+			err = doc.parseTable(decoder, start)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func isODSElement(start xml.StartElement, namespace, local string) bool {
+	return start.Name.Space == namespace && start.Name.Local == local
+}
+
+// xmlAttr returns the value of an attribute, empty when it is missing
+func xmlAttr(start xml.StartElement, namespace, local string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == namespace && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// odsCount reads a repeat or span attribute, 1 when missing
+func odsCount(start xml.StartElement, local string) int {
+	count, err := strconv.Atoi(xmlAttr(start, odsTableNS, local))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+// odsLength converts a length such as "2.258cm" into points
+func odsLength(value string) (float64, bool) {
+	units := map[string]float64{"cm": 72 / 2.54, "mm": 72 / 25.4, "in": 72, "pt": 1, "pc": 12, "px": 0.75}
+	for unit, points := range units {
+		if number, ok := strings.CutSuffix(value, unit); ok {
+			length, err := strconv.ParseFloat(number, 64)
+			return length * points, err == nil
+		}
+	}
+	return 0, false
+}
+
+// parseStyle records the size given by a column or row style
+func (doc *odsDocument) parseStyle(decoder *xml.Decoder, start xml.StartElement) error {
+	name := xmlAttr(start, odsStyleNS, "name")
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if isODSElement(token, odsStyleNS, "table-column-properties") {
+				if width, ok := odsLength(xmlAttr(token, odsStyleNS, "column-width")); ok {
+					doc.columnWidths[name] = width
+				}
+			}
+			if isODSElement(token, odsStyleNS, "table-row-properties") {
+				if height, ok := odsLength(xmlAttr(token, odsStyleNS, "row-height")); ok {
+					doc.rowHeights[name] = height
+				}
+			}
+			if err := decoder.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// parseTable reads one sheet with its columns, rows, form controls and the
+// shapes placed on the sheet
+func (doc *odsDocument) parseTable(decoder *xml.Decoder, start xml.StartElement) error {
+	sheet := &odsSheet{name: xmlAttr(start, odsTableNS, "name")}
+	doc.sheets = append(doc.sheets, sheet)
+	if err := checkLimit(LimitSheets, int64(len(doc.sheets)), int64(doc.limits.MaxSheets)); err != nil {
+		return err
+	}
+
+	depth := 1
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch {
+			case isODSElement(token, odsTableNS, "table-column"):
+				width, ok := doc.columnWidths[xmlAttr(token, odsTableNS, "style-name")]
+				if !ok {
+					width = odsDefaultColumnWidth
+				}
+				sheet.columns = append(sheet.columns, odsSpan{count: odsCount(token, "number-columns-repeated"), size: width})
+				err = decoder.Skip()
+			case isODSElement(token, odsTableNS, "table-row"):
+				err = doc.parseRow(decoder, token, sheet)
+			case isODSElement(token, odsFormNS, "checkbox"):
+				doc.addCheckBox(token)
+				err = decoder.Skip()
+			case isODSElement(token, odsDrawNS, "control"), isODSElement(token, odsDrawNS, "frame"):
+				var shape odsShape
+				shape, err = parseODSShape(decoder, token)
+				shape.row = -1
+				sheet.shapes = append(sheet.shapes, shape)
+			default:
+				// containers such as table:shapes, office:forms and row groups
+				depth++
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return nil
+}
+
+func (doc *odsDocument) addCheckBox(start xml.StartElement) {
+	state := xmlAttr(start, odsFormNS, "current-state")
+	if state == "" {
+		state = xmlAttr(start, odsFormNS, "state")
+	}
+	checkBox := odsCheckBox{
+		label:      xmlAttr(start, odsFormNS, "label"),
+		checked:    state == "checked",
+		linkedCell: xmlAttr(start, odsFormNS, "linked-cell"),
+	}
+	// controls are referenced by form:id or, since ODF 1.2, by xml:id
+	for _, id := range []string{xmlAttr(start, odsFormNS, "id"), xmlAttr(start, odsXMLNS, "id")} {
+		if id != "" {
+			doc.checkBoxes[id] = checkBox
+		}
+	}
+}
+
+// parseRow reads the cells of a row. Cells of a repeated row are copied to
+// every repetition, its merges and shapes are kept on the first.
+func (doc *odsDocument) parseRow(decoder *xml.Decoder, start xml.StartElement, sheet *odsSheet) error {
+	row := sheet.rowNum
+	repeat := odsCount(start, "number-rows-repeated")
+	height, ok := doc.rowHeights[xmlAttr(start, odsTableNS, "style-name")]
+	if !ok {
+		height = odsDefaultRowHeight
+	}
+	sheet.rows = append(sheet.rows, odsSpan{count: repeat, size: height})
+	sheet.rowNum += repeat
+
+	firstCell := len(sheet.cells)
+	col := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if !isODSElement(token, odsTableNS, "table-cell") && !isODSElement(token, odsTableNS, "covered-table-cell") {
+				if err := decoder.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			columns, err := doc.parseCell(decoder, token, sheet, row, col)
+			if err != nil {
+				return err
+			}
+			col += columns
+		case xml.EndElement:
+			cells := sheet.cells[firstCell:]
+			if len(cells) == 0 {
+				return nil
+			}
+			if err := doc.limits.checkRows(sheet.name, row+repeat); err != nil {
+				return err
+			}
+			if err := doc.addCells(len(cells) * (min(repeat, excelize.TotalRows-row) - 1)); err != nil {
+				return err
+			}
+			for i := 1; i < repeat && row+i < excelize.TotalRows && len(cells) > 0; i++ {
+				for _, cell := range cells {
+					sheet.cells = append(sheet.cells, odsCell{row: row + i, col: cell.col, text: cell.text})
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// parseCell reads a cell of sheet and returns the number of columns it covers
+func (doc *odsDocument) parseCell(decoder *xml.Decoder, start xml.StartElement, sheet *odsSheet, row, col int) (int, error) {
+	repeat := odsCount(start, "number-columns-repeated")
+	covered := start.Name.Local == "covered-table-cell"
+	if !covered {
+		colSpan, rowSpan := odsCount(start, "number-columns-spanned"), odsCount(start, "number-rows-spanned")
+		if colSpan > 1 || rowSpan > 1 {
+			sheet.merges = append(sheet.merges, importedArea{firstRow: row, lastRow: row + rowSpan - 1, firstCol: col, lastCol: col + colSpan - 1})
+		}
+	}
+
+	var paragraphs []string
+	hasParagraph := false
+	for done := false; !done; {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch {
+			case isODSElement(token, odsTextNS, "p"):
+				hasParagraph = true
+				var text string
+				text, err = sheet.parseParagraph(decoder, row, col)
+				paragraphs = append(paragraphs, text)
+			case isODSElement(token, odsDrawNS, "control"), isODSElement(token, odsDrawNS, "frame"):
+				var shape odsShape
+				shape, err = parseODSShape(decoder, token)
+				shape.row, shape.col = row, col
+				sheet.shapes = append(sheet.shapes, shape)
+			default:
+				// comments (office:annotation) and anything else are not cell text
+				err = decoder.Skip()
+			}
+			if err != nil {
+				return 0, err
+			}
+		case xml.EndElement:
+			done = true
+		}
+	}
+
+	text := strings.Join(paragraphs, "\n")
+	if !hasParagraph {
+		text = odsValue(start)
+	}
+	if text != "" && !covered {
+		if err := doc.addCells(min(repeat, excelize.MaxColumns-col)); err != nil {
+			return 0, err
+		}
+		for i := 0; i < repeat && col+i < excelize.MaxColumns; i++ {
+			sheet.cells = append(sheet.cells, odsCell{row: row, col: col + i, text: text})
+		}
+	}
+	return repeat, nil
+}
+
+// addCells counts cells about to be added, failing past MaxCells
+func (doc *odsDocument) addCells(count int) error {
+	doc.cellCount += count
+	return checkLimit(LimitCells, int64(doc.cellCount), int64(doc.limits.MaxCells))
+}
+
+// odsValue is the value of a cell without displayed text
+func odsValue(start xml.StartElement) string {
+	for _, local := range []string{"string-value", "value", "date-value", "time-value", "boolean-value"} {
+		if value := xmlAttr(start, odsOfficeNS, local); value != "" {
+			if local == "boolean-value" {
+				return strings.ToUpper(value)
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// parseParagraph returns the text of a text:p, images anchored in the text
+// are placed in the cell. White space in the XML collapses into one space and
+// is dropped at the start, explicit spaces are text:s elements.
+func (sheet *odsSheet) parseParagraph(decoder *xml.Decoder, row, col int) (string, error) {
+	var text strings.Builder
+	collapsed := true // at a collapsed space or the start of the paragraph
+	depth := 1
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		switch token := token.(type) {
+		case xml.CharData:
+			for _, r := range string(token) {
+				space := r == ' ' || r == '\t' || r == '\n' || r == '\r'
+				if space && collapsed {
+					continue
+				}
+				if space {
+					r = ' '
+				}
+				text.WriteRune(r)
+				collapsed = space
+			}
+		case xml.StartElement:
+			switch {
+			case isODSElement(token, odsTextNS, "s"):
+				count, err := strconv.Atoi(xmlAttr(token, odsTextNS, "c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				text.WriteString(strings.Repeat(" ", count))
+				collapsed = false
+			case isODSElement(token, odsTextNS, "tab"):
+				text.WriteString("\t")
+				collapsed = false
+			case isODSElement(token, odsTextNS, "line-break"):
+				text.WriteString("\n")
+				collapsed = false
+			case isODSElement(token, odsDrawNS, "frame"):
+				shape, err := parseODSShape(decoder, token)
+				if err != nil {
+					return "", err
+				}
+				shape.row, shape.col = row, col
+				sheet.shapes = append(sheet.shapes, shape)
+				continue
+			case isODSElement(token, odsOfficeNS, "annotation"), isODSElement(token, odsTextNS, "note"):
+				if err := decoder.Skip(); err != nil {
+					return "", err
+				}
+				continue
+			}
+			// spans and links keep their text
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return text.String(), nil
+}
+
+// parseODSShape reads a draw:control or a draw:frame with its first image
+func parseODSShape(decoder *xml.Decoder, start xml.StartElement) (odsShape, error) {
+	shape := odsShape{control: xmlAttr(start, odsDrawNS, "control")}
+	shape.x, _ = odsLength(xmlAttr(start, odsSVGNS, "x"))
+	shape.y, _ = odsLength(xmlAttr(start, odsSVGNS, "y"))
+
+	depth := 1
+	for depth > 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return shape, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if isODSElement(token, odsDrawNS, "image") && shape.image == "" {
+				shape.image = xmlAttr(token, odsXLinkNS, "href")
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return shape, nil
+}
+
+// spanIndex returns the 0-based column or row at a position in points and
+// the distance from its edge
+func spanIndex(spans []odsSpan, position, defaultSize float64) (int, float64) {
+	index := 0
+	for _, span := range spans {
+		if position < float64(span.count)*span.size {
+			n := int(position / span.size)
+			return index + n, position - float64(n)*span.size
+		}
+		position -= float64(span.count) * span.size
+		index += span.count
+	}
+	n := int(position / defaultSize)
+	return index + n, position - float64(n)*defaultSize
+}
+
+// anchor returns the cell a shape is placed in and its offset from the cell
+// in pixels
+func (sheet *odsSheet) anchor(shape odsShape) (row, col, offsetX, offsetY int) {
+	if shape.row >= 0 {
+		return shape.row, shape.col, 0, 0
+	}
+	row, y := spanIndex(sheet.rows, shape.y, odsDefaultRowHeight)
+	col, x := spanIndex(sheet.columns, shape.x, odsDefaultColumnWidth)
+	if row >= excelize.TotalRows || col >= excelize.MaxColumns {
+		return min(row, excelize.TotalRows-1), min(col, excelize.MaxColumns-1), 0, 0
+	}
+	return row, col, int(pointsToPixels(x)), int(pointsToPixels(y))
+}
+
+func pointsToPixels(points float64) float64 {
+	return points * 4 / 3
+}
+
+// odsCellReference converts a cell link such as "$'Buyer Details'.$B$4"
+// into "'Buyer Details'!$B$4"
+func odsCellReference(reference string) string {
+	dot := strings.LastIndex(reference, ".")
+	if dot < 0 {
+		return reference
+	}
+	sheetName := strings.TrimPrefix(reference[:dot], "$")
+	if sheetName == "" {
+		return reference[dot+1:]
+	}
+	return sheetName + "!" + reference[dot+1:]
+}
+
+// setSizes copies the column widths and row heights set by styles, up to
+// the last used column and row
+func (sheet *odsSheet) setSizes(workbook *MemoryWorkbook, lastRow, lastCol int) error {
+	col := 1
+	for _, span := range sheet.columns {
+		for i := 0; i < span.count && col <= lastCol; i, col = i+1, col+1 {
+			if span.size == odsDefaultColumnWidth {
+				continue
+			}
+			// widths are in characters of 7 pixels plus 5 pixels of padding
+			width := max(0, (pointsToPixels(span.size)-5)/7)
+			if err := workbook.SetColumnWidth(sheet.name, col, width); err != nil {
+				return err
+			}
+		}
+	}
+
+	row := 1
+	for _, span := range sheet.rows {
+		for i := 0; i < span.count && row <= lastRow; i, row = i+1, row+1 {
+			if span.size == odsDefaultRowHeight {
+				continue
+			}
+			if err := workbook.SetRowHeight(sheet.name, row, span.size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toWorkbook builds the workbook of the parsed spreadsheet. Images are only
+// recorded, the extractor only asks whether a cell holds one.
+func (doc *odsDocument) toWorkbook() (*MemoryWorkbook, error) {
+	if len(doc.sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no worksheets")
+	}
+
+	workbook := &MemoryWorkbook{}
+	for _, sheet := range doc.sheets {
+		if err := workbook.AddSheet(sheet.name); err != nil {
+			return nil, err
+		}
+
+		lastRow, lastCol := 0, 0
+		for _, cell := range sheet.cells {
+			name, err := excelize.CoordinatesToCellName(cell.col+1, cell.row+1)
+			if err != nil {
+				return nil, err
+			}
+			if err := workbook.SetCellValue(sheet.name, name, cell.text); err != nil {
+				return nil, err
+			}
+			lastRow, lastCol = max(lastRow, cell.row+1), max(lastCol, cell.col+1)
+		}
+
+		for _, merge := range sheet.merges {
+			// the merge index holds every row of a merged range, so a range
+			// running past the cells in use is clipped to them
+			if merge.firstRow >= lastRow || merge.firstCol >= lastCol {
+				continue
+			}
+			start, err := excelize.CoordinatesToCellName(merge.firstCol+1, merge.firstRow+1)
+			if err != nil {
+				return nil, err
+			}
+			end, err := excelize.CoordinatesToCellName(min(merge.lastCol+1, lastCol), min(merge.lastRow+1, lastRow))
+			if err != nil {
+				return nil, err
+			}
+			if err := workbook.MergeCells(sheet.name, start, end); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, shape := range sheet.shapes {
+			row, col, offsetX, offsetY := sheet.anchor(shape)
+			cell, err := excelize.CoordinatesToCellName(col+1, row+1)
+			if err != nil {
+				return nil, err
+			}
+			lastRow, lastCol = max(lastRow, row+2), max(lastCol, col+2)
+
+			if checkBox, ok := doc.checkBoxes[shape.control]; ok && shape.control != "" {
+				err = workbook.AddFormControl(sheet.name, FormControl{
+					Cell:     cell,
+					Type:     FormControlCheckBox,
+					Text:     checkBox.label,
+					Checked:  checkBox.checked,
+					CellLink: odsCellReference(checkBox.linkedCell),
+					OffsetX:  offsetX,
+					OffsetY:  offsetY,
+				})
+			}
+			if err == nil && shape.image != "" {
+				err = workbook.AddPicture(sheet.name, cell)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := sheet.setSizes(workbook, lastRow, lastCol); err != nil {
+			return nil, err
+		}
+	}
+	return workbook, nil
+}
@@ -0,0 +1,131 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// odsContent returns the content.xml of a spreadsheet holding one sheet with
+// the given table rows
+func odsContent(rows string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet><table:table table:name="Sheet1">` + rows + `</table:table></office:spreadsheet></office:body></office:document-content>`
+}
+
+// odsPackageData returns an OpenDocument spreadsheet holding one sheet with
+// the given table rows
+func odsPackageData(t *testing.T, rows string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := zip.NewWriter(&buffer)
+	for name, data := range map[string]string{"mimetype": odsMimetype, "content.xml": odsContent(rows)} {
+		entry, err := w.Create(name)
+		if err == nil {
+			_, err = entry.Write([]byte(data))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestOpenODS(t *testing.T) {
+	data := odsPackageData(t, `
+<table:table-row><table:table-cell table:number-columns-spanned="2"><text:p>Buyer</text:p></table:table-cell><table:covered-table-cell/><table:table-cell office:value-type="float" office:value="42"/></table:table-row>
+<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="2"><text:p>x</text:p></table:table-cell></table:table-row>
+<table:table-row><table:table-cell table:number-columns-spanned="1024" table:number-rows-spanned="1048576"><text:p>Notes</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1048000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>`)
+
+	f, err := openWorkbook(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.Rows("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"Buyer", "", "42"}, {"x", "x"}, {"x", "x"}, {"Notes"}}
+	if len(rows) != len(want) {
+		t.Fatalf("got rows %q, want %q", rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d = %q, want %q", i+1, rows[i], want[i])
+		}
+	}
+
+	// the spanned cell running past the cells in use is clipped to them
+	merges, err := f.MergedRanges("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, merge := range merges {
+		got = append(got, merge.StartCell+":"+merge.EndCell)
+	}
+	if strings.Join(got, ",") != "A1:B1,A4:C4" {
+		t.Errorf("got merged ranges %q, want [A1:B1 A4:C4]", got)
+	}
+}
+
+func TestParseODSContentLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "repeated rows",
+			rows:   `<table:table-row table:number-rows-repeated="300000"><table:table-cell table:number-columns-repeated="20"><text:p>x</text:p></table:table-cell></table:table-row>`,
+			limits: DefaultLimits(),
+			want:   LimitRows,
+		},
+		{
+			name:   "repeated columns",
+			rows:   `<table:table-row table:number-rows-repeated="1000"><table:table-cell table:number-columns-repeated="16384"><text:p>x</text:p></table:table-cell></table:table-row>`,
+			limits: DefaultLimits(),
+			want:   LimitCells,
+		},
+		{
+			name:   "cells",
+			rows:   `<table:table-row><table:table-cell table:number-columns-repeated="11"><text:p>x</text:p></table:table-cell></table:table-row>`,
+			limits: Limits{MaxCells: 10},
+			want:   LimitCells,
+		},
+		{
+			name:   "sheets",
+			rows:   `</table:table><table:table table:name="Sheet2">`,
+			limits: Limits{MaxSheets: 1},
+			want:   LimitSheets,
+		},
+		{
+			name:   "empty repeated rows",
+			rows:   `<table:table-row><table:table-cell><text:p>x</text:p></table:table-cell></table:table-row><table:table-row table:number-rows-repeated="1048575"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>`,
+			limits: DefaultLimits(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseODSContent(strings.NewReader(odsContent(test.rows)), test.limits)
+			var limitErr LimitExceededError
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case test.want != "" && (!errors.As(err, &limitErr) || limitErr.Limit != test.want):
+				t.Errorf("got %v, want the %s limit", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/richardlehane/mscfb"
+	"github.com/xuri/excelize/v2"
+)
+
+// oleSignature starts every OLE compound file, the container of encrypted
+// OOXML workbooks and of legacy .xls workbooks
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// OpenOptions are the settings used to open a workbook
+type OpenOptions struct {
+	// Passwords are tried in order on an encrypted workbook, e.g. the
+	// candidates configured for a supplier
+	Passwords []string
+	// Limits bound the workbooks accepted, none by default
+	Limits Limits
+}
+
+// limits returns the limits of the options, none when options is nil
+func (o *OpenOptions) limits() Limits {
+	if o == nil {
+		return Limits{}
+	}
+	return o.Limits
+}
+
+// openWorkbook opens the workbook held in data within the limits of the
+// options. A workbook over a limit fails with a LimitExceededError, sheets
+// with more rows than allowed when they are read.
+func openWorkbook(data []byte, options *OpenOptions) (Workbook, error) {
+	limits := options.limits()
+	if err := checkLimit(LimitFileSize, int64(len(data)), limits.MaxFileSize); err != nil {
+		return nil, err
+	}
+
+	workbook, err := openPackage(data, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.checkWorkbook(workbook); err != nil {
+		workbook.Close()
+		return nil, err
+	}
+	if limits.MaxRows > 0 {
+		return &limitedWorkbook{Workbook: workbook, maxRows: limits.MaxRows}, nil
+	}
+	return workbook, nil
+}
+
+// openPackage opens the workbook held in data. The format is detected by
+// signature: OLE compound files are either encrypted OOXML workbooks, which
+// are decrypted with the first matching password, or legacy .xls workbooks,
+// and zip packages are OpenDocument spreadsheets or OOXML workbooks.
+func openPackage(data []byte, options *OpenOptions) (Workbook, error) {
+	limits := options.limits()
+	if !bytes.HasPrefix(data, oleSignature) {
+		return openZipPackage(data, limits)
+	}
+
+	streams, err := readOLEStreams(data, "EncryptedPackage", "Workbook")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := streams["EncryptedPackage"]; ok {
+		return openEncryptedWorkbook(data, options)
+	}
+	if stream, ok := streams["Workbook"]; ok {
+		return openExcelize(openXLS(stream, limits))
+	}
+	return nil, excelize.ErrWorkbookFileFormat
+}
+
+// openZipPackage opens an OpenDocument spreadsheet or an OOXML workbook
+// once its unzipped size and pictures are within the limits
+func openZipPackage(data []byte, limits Limits) (Workbook, error) {
+	if pkg, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		if err := limits.checkPackage(pkg); err != nil {
+			return nil, err
+		}
+		if isODSPackage(pkg) {
+			return openODS(pkg, limits)
+		}
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data), limits.excelizeOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &excelizeWorkbook{file: f, data: data}, nil
+}
+
+// openExcelize wraps the result of opening a workbook with excelize
+func openExcelize(f *excelize.File, err error) (Workbook, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &excelizeWorkbook{file: f}, nil
+}
+
+func openEncryptedWorkbook(data []byte, options *OpenOptions) (Workbook, error) {
+	var passwords []string
+	if options != nil {
+		passwords = options.Passwords
+	}
+	if len(passwords) == 0 {
+		return nil, PasswordRequiredError{}
+	}
+
+	for _, password := range passwords {
+		// a wrong password fails the decryption or decrypts to something
+		// that is not a zip package
+		decrypted, err := excelize.Decrypt(data, &excelize.Options{Password: password})
+		if err != nil || len(decrypted) == 0 {
+			continue
+		}
+		if _, err := zip.NewReader(bytes.NewReader(decrypted), int64(len(decrypted))); err != nil {
+			continue
+		}
+		return openZipPackage(decrypted, options.limits())
+	}
+	return nil, WrongPasswordError{tried: len(passwords)}
+}
+
+// readOLEStreams returns the streams of an OLE compound file found among
+// names. Only the "EncryptedPackage" marker is not read, as it can be large.
+func readOLEStreams(data []byte, names ...string) (map[string][]byte, error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OLE compound file: %w", err)
+	}
+
+	streams := map[string][]byte{}
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		for _, name := range names {
+			if entry.Name != name || len(entry.Path) > 0 {
+				continue
+			}
+			if name == "EncryptedPackage" {
+				streams[name] = nil
+				continue
+			}
+			stream, err := io.ReadAll(entry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s stream: %w", name, err)
+			}
+			streams[name] = stream
+		}
+	}
+	return streams, nil
+}
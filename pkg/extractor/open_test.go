@@ -0,0 +1,72 @@
+package extractor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// encryptTestWorkbook encrypts the workbook at path with password
+func encryptTestWorkbook(t *testing.T, path string, password string) {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.SaveAs(path, excelize.Options{Password: password}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenEncryptedWorkbook(t *testing.T) {
+	sheet := testSheet{name: "Buyer Details", values: map[string]string{"B12": "Part Number", "E12": "PN-1"}}
+	plainPath := writeTestWorkbook(t, sheet)
+	encryptedPath := writeTestWorkbook(t, sheet)
+	encryptTestWorkbook(t, encryptedPath, "secret")
+
+	tests := []struct {
+		name      string
+		path      string
+		passwords []string
+		wantErr   error
+	}{
+		{name: "plain workbook without passwords", path: plainPath},
+		{name: "plain workbook with passwords", path: plainPath, passwords: []string{"secret"}},
+		{name: "encrypted workbook without passwords", path: encryptedPath, wantErr: PasswordRequiredError{}},
+		{name: "encrypted workbook with wrong passwords", path: encryptedPath, passwords: []string{"guess", "Secret"}, wantErr: WrongPasswordError{tried: 2}},
+		{name: "encrypted workbook with the second candidate", path: encryptedPath, passwords: []string{"guess", "secret"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := MakeSECCFExtractorWithOptions(test.path, CompanyNameList{"Amazon"}, &OpenOptions{Passwords: test.passwords})
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("got error %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+
+			extraction := e.Extract()
+			if extraction.BuyerDetails == nil || extraction.BuyerDetails.PartNumber != "PN-1" {
+				t.Errorf("got buyer details %+v, want the part number PN-1", extraction.BuyerDetails)
+			}
+		})
+	}
+}
+
+func TestPasswordErrors(t *testing.T) {
+	if got := (WrongPasswordError{tried: 3}).Error(); !strings.Contains(got, "3 password(s)") {
+		t.Errorf("got %q, want the number of passwords tried", got)
+	}
+	var err error = PasswordRequiredError{}
+	if errors.As(err, &WrongPasswordError{}) {
+		t.Error("a missing password is reported as a wrong one")
+	}
+}
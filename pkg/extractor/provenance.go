@@ -0,0 +1,63 @@
+package extractor
+
+// Fallbacks recorded in the provenance of a field
+const (
+	FallbackAlternateCellRange = "alternate_cell_range" // label found at a later cell range than the first
+	FallbackLabelSearch        = "label_search"         // label found by scanning the sheet
+	FallbackMergedCell         = "merged_cell"          // value read from the top-left cell of a merged range
+	FallbackNearestCheckBox    = "nearest_checkbox"     // checkbox anchored outside its target cell
+	FallbackLinkedCell         = "linked_cell"          // checkbox state taken from its linked cell
+	FallbackGlyph              = "glyph"                // checkbox state read from a typed mark
+)
+
+// FieldProvenance records where the value of one extracted field came from
+type FieldProvenance struct {
+	Section    string          `json:"section"`
+	Field      string          `json:"field"`
+	SheetName  string          `json:"sheet_name"`
+	LabelCell  string          `json:"label_cell,omitempty"`
+	LabelText  string          `json:"label_text,omitempty"`
+	ValueCells []string        `json:"value_cells,omitempty"`
+	Extractor  string          `json:"extractor"`
+	RawValue   string          `json:"raw_value,omitempty"` // cell text before trimming
+	Controls   []CheckBoxMatch `json:"controls,omitempty"`  // checkbox states the value was decided from
+	Fallbacks  []string        `json:"fallbacks,omitempty"`
+}
+
+// FieldValue is returned by every ValueExtractor. Value is set on the
+// extracted field, the rest explains where it came from.
+type FieldValue struct {
+	Value      interface{}
+	ValueCells []string
+	RawValue   string
+	Matches    []CheckBoxMatch
+	Option     *OptionResult
+	Fallbacks  []string
+}
+
+// checkBoxFallbacks lists the fallbacks taken to decide a checkbox state
+func checkBoxFallbacks(match CheckBoxMatch) []string {
+	var fallbacks []string
+	if match.Found && match.Distance > 0 {
+		fallbacks = append(fallbacks, FallbackNearestCheckBox)
+	}
+	switch match.Method {
+	case DetectionLinkedCell:
+		fallbacks = append(fallbacks, FallbackLinkedCell)
+	case DetectionGlyph:
+		fallbacks = append(fallbacks, FallbackGlyph)
+	}
+	return fallbacks
+}
+
+// recordProvenance stores the provenance of a field, replacing an earlier
+// record of the same field
+func (e *ExcelExtractor) recordProvenance(provenance FieldProvenance) {
+	for i, existing := range e.Extraction.Provenance {
+		if existing.Section == provenance.Section && existing.Field == provenance.Field {
+			e.Extraction.Provenance[i] = provenance
+			return
+		}
+	}
+	e.Extraction.Provenance = append(e.Extraction.Provenance, provenance)
+}
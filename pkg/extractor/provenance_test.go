@@ -0,0 +1,116 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	template := &FormTemplate{
+		Name: "provenance",
+		Sections: []SectionTemplate{
+			{
+				Name:  SectionBuyerDetails,
+				Sheet: "buyer details",
+				Fields: map[string]SearchCriteria{
+					"PartNumber": {
+						SearchTerms: []string{"part number"},
+						CellRanges:  []CellRange{{StartCell: "B12", EndCell: "D12"}},
+						Offset:      3,
+						LabelSearch: true,
+					},
+					"BuildToPrint": {
+						SearchTerms:     []string{"build to print"},
+						CellRanges:      []CellRange{{StartCell: "B21", EndCell: "F21"}},
+						BoolCheckBox:    true,
+						BoolClfCriteria: BoolClassificationCriteria{Offset: 4, SearchTerms: []string{"YES"}},
+					},
+				},
+			},
+			{
+				Name:  SectionControlledContent,
+				Sheet: "controlled content",
+				Columns: []ColumnMapping{
+					{FieldName: "ItemNum", SearchTerms: []string{"Item"}},
+					{FieldName: "PartNumber", SearchTerms: []string{"part number"}},
+				},
+			},
+		},
+	}
+	e := newTestExtractor(t, template,
+		testSheet{
+			name: "Buyer Details",
+			// the part number label moved down two rows
+			values: map[string]string{"B14": "Part Number", "E14": " PN-1 ", "B21": "Build To Print"},
+			// the checkbox sits one cell right of its value cell
+			controls: []FormControl{{Cell: "G21", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+		},
+		testSheet{
+			name: "Controlled Content",
+			values: map[string]string{
+				"A3": "Item", "B3": "Part Number",
+				"A4": "1", "B4": "P-1",
+				"A5": "2", "B5": "P-2",
+			},
+		},
+	)
+	e.Extract()
+
+	want := map[string]FieldProvenance{
+		SectionBuyerDetails + ".PartNumber": {
+			Section:    SectionBuyerDetails,
+			Field:      "PartNumber",
+			SheetName:  "Buyer Details",
+			LabelCell:  "B14",
+			LabelText:  "Part Number",
+			ValueCells: []string{"E14"},
+			Extractor:  "SimpleValueExtractor",
+			RawValue:   " PN-1 ",
+			Fallbacks:  []string{FallbackLabelSearch},
+		},
+		SectionBuyerDetails + ".BuildToPrint": {
+			Section:    SectionBuyerDetails,
+			Field:      "BuildToPrint",
+			SheetName:  "Buyer Details",
+			LabelCell:  "B21",
+			LabelText:  "Build To Print",
+			ValueCells: []string{"F21"},
+			Extractor:  "BoolCheckBoxExtractor",
+			Fallbacks:  []string{FallbackNearestCheckBox},
+		},
+		SectionControlledContent + ".ItemNum": {
+			Section:    SectionControlledContent,
+			Field:      "ItemNum",
+			SheetName:  "Controlled Content",
+			LabelCell:  "A3",
+			LabelText:  "item",
+			ValueCells: []string{"A4:A5"},
+			Extractor:  "ColumnMapping",
+		},
+		SectionControlledContent + ".PartNumber": {
+			Section:    SectionControlledContent,
+			Field:      "PartNumber",
+			SheetName:  "Controlled Content",
+			LabelCell:  "B3",
+			LabelText:  "part number",
+			ValueCells: []string{"B4:B5"},
+			Extractor:  "ColumnMapping",
+		},
+	}
+
+	if len(e.Extraction.Provenance) != len(want) {
+		t.Errorf("got %d provenance records, want %d", len(e.Extraction.Provenance), len(want))
+	}
+	for _, got := range e.Extraction.Provenance {
+		key := got.Section + "." + got.Field
+		if got.Field == "BuildToPrint" {
+			if len(got.Controls) != 1 || got.Controls[0].ControlCell != "G21" || !got.Controls[0].Checked {
+				t.Errorf("%s: got controls %+v, want the checked checkbox at G21", key, got.Controls)
+			}
+			got.Controls = nil
+		}
+		if !reflect.DeepEqual(got, want[key]) {
+			t.Errorf("%s: got %+v\nwant %+v", key, got, want[key])
+		}
+	}
+}
@@ -1,62 +1,77 @@
 package extractor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"sort"
 	"strings"
-
-	"github.com/adhadse/excelFormExtractor/pkg/utils"
-	"github.com/xuri/excelize/v2"
+	"sync"
 )
 
 // SearchCriteria defines what to look for and where
 type SearchCriteria struct {
-	SearchTerms           []string                   // Multiple possible terms to search for
-	CellRanges            []CellRange                // Multiple cell ranges to search in
-	DualColumnCheckBoxClf bool                       // check side by side column
-	DualColumnClfCriteria DualClassificationCriteria // Add this to map checkbox text to values
-	TriColumnCheckBoxClf  bool                       // check tri-side by side column
-	TriColumnClfCriteria  TriClassificationCritera   // Add this to map checkbox text to values
-	BoolCheckBox          bool
-	BoolClfCriteria       BoolClassificationCriteria
-	BoolContainsImage     bool
-	BoolClfContainsImage  BoolClassificationCriteria
-	Offset                int // Default offset of value for simple fields
+	SearchTerms          []string                   `json:"search_terms" yaml:"search_terms"`           // Multiple possible terms to search for
+	CellRanges           []CellRange                `json:"cell_ranges" yaml:"cell_ranges"`             // Multiple cell ranges to search in
+	Options              []ClassificationCriteria   `json:"options,omitempty" yaml:"options,omitempty"` // option group, one checkbox per labelled option
+	BoolCheckBox         bool                       `json:"bool_checkbox,omitempty" yaml:"bool_checkbox,omitempty"`
+	BoolClfCriteria      BoolClassificationCriteria `json:"bool_clf_criteria,omitempty" yaml:"bool_clf_criteria,omitempty"`
+	BoolContainsImage    bool                       `json:"bool_contains_image,omitempty" yaml:"bool_contains_image,omitempty"`
+	BoolClfContainsImage BoolClassificationCriteria `json:"bool_clf_contains_image,omitempty" yaml:"bool_clf_contains_image,omitempty"`
+	Offset               int                        `json:"offset,omitempty" yaml:"offset,omitempty"`                         // Default offset of value for simple fields
+	RowOffset            int                        `json:"row_offset,omitempty" yaml:"row_offset,omitempty"`                 // rows below (or above when negative) the label
+	LabelSearch          bool                       `json:"label_search,omitempty" yaml:"label_search,omitempty"`             // scan the sheet for the label when no cell range matches
+	SearchRegion         *CellRange                 `json:"search_region,omitempty" yaml:"search_region,omitempty"`           // optional bounding region of the label scan
+	CheckBoxTolerance    float64                    `json:"checkbox_tolerance,omitempty" yaml:"checkbox_tolerance,omitempty"` // pixels a checkbox may sit outside its cell
 }
 
 type ColumnMapping struct {
-	FieldName   string
-	SearchTerms []string
-	FoundColumn string // Will store the actual column letter once found
+	FieldName   string   `json:"field_name" yaml:"field_name"`
+	SearchTerms []string `json:"search_terms" yaml:"search_terms"`
+	FoundColumn string   `json:"-" yaml:"-"` // Will store the actual column letter once found
 }
 
 type ClassificationCriteria struct {
-	Label       string
-	SearchTerms []string // search terms for extra check if form control has that name or not
-	Offset      int
+	Label       string   `json:"label" yaml:"label"`
+	SearchTerms []string `json:"search_terms" yaml:"search_terms"` // search terms for extra check if form control has that name or not
+	Offset      int      `json:"offset" yaml:"offset"`
+	RowOffset   int      `json:"row_offset,omitempty" yaml:"row_offset,omitempty"`
 }
 
 type BoolClassificationCriteria struct {
-	Offset      int
-	SearchTerms []string // search terms for extra check if form control has that name or not
-}
-
-type DualClassificationCriteria struct {
-	TYPE_1 ClassificationCriteria
-	TYPE_2 ClassificationCriteria
-}
+	Offset      int      `json:"offset" yaml:"offset"`
+	RowOffset   int      `json:"row_offset,omitempty" yaml:"row_offset,omitempty"`
+	SearchTerms []string `json:"search_terms" yaml:"search_terms"` // search terms for extra check if form control has that name or not
+}
+
+// Status of an option group
+const (
+	OptionSelected = "selected" // exactly one option is checked
+	OptionNone     = "none"     // no option is checked
+	OptionConflict = "conflict" // more than one option is checked
+	// a mark typed into a cell shared by several options, which one it ticks
+	// is unknown
+	OptionUndecidable = "undecidable"
+)
 
-type TriClassificationCritera struct {
-	TYPE_1 ClassificationCriteria
-	TYPE_2 ClassificationCriteria
-	TYPE_3 ClassificationCriteria
+// OptionResult is the outcome of an option group. Options lists the options
+// involved: the checked ones on a conflict, all of them when none is checked.
+type OptionResult struct {
+	Field     string          `json:"field"`
+	SheetName string          `json:"sheet_name"`
+	Status    string          `json:"status"`
+	Selected  string          `json:"selected,omitempty"`
+	Options   []string        `json:"options,omitempty"`
+	Matches   []CheckBoxMatch `json:"-"`
 }
 
 // CellRange represents an Excel cell range
 type CellRange struct {
-	StartCell string // e.g., "B12"
-	EndCell   string // e.g., "D12"
+	StartCell string `json:"start_cell" yaml:"start_cell"` // e.g., "B12"
+	EndCell   string `json:"end_cell" yaml:"end_cell"`     // e.g., "D12"
 }
 
 type BuyerDetails struct {
@@ -149,20 +164,42 @@ type SECCFExtraction struct {
 	BuyerDetails      *BuyerDetails   `json:"buyer_details"`
 	ProductDetails    *ProductDetails `json:"product_details"`
 	ControlledContent []ControlCotent `json:"controlled_content"`
+	// header row the controlled content table was read from
+	ControlledContentHeader *HeaderMatch `json:"controlled_content_header,omitempty"`
+	// checkboxes the checkbox fields were decided from
+	CheckBoxMatches []CheckBoxMatch `json:"checkbox_matches,omitempty"`
+	// outcome of every option group, including "none" and "conflict"
+	OptionResults []OptionResult `json:"option_results,omitempty"`
+	// problems met during extraction, in the order they were found
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// where every field came from, only written by ToJson when requested
+	Provenance []FieldProvenance `json:"provenance,omitempty"`
 	// add more extraction if possible
 }
 
 type ExcelExtractor struct {
-	file         *excelize.File
+	workbook     Workbook
 	companyNames []string
+	template     *FormTemplate
+	ctx          context.Context // checked between sections, fields and rows
+	sheets       *sheetCache     // sheets read so far, shared with the section extractors
+	limitErr     error           // first limit a sheet ran into
+	geometries   map[string]*sheetGeometry
 	Extraction   *SECCFExtraction
+	// IncludeProvenance makes ToJson emit the provenance of every field
+	IncludeProvenance bool
+	// Sequential extracts the sections one after another instead of at the
+	// same time, e.g. for debugging. The result is the same.
+	Sequential bool
 }
 
 // //////////////////////////
 // // Specific extractor ////
 // //////////////////////////
 
-// Add a method to handle value extraction based on criteria type
+// Add a method to handle value extraction based on criteria type.
+// Implementations read the workbook only through e.Workbook() and the helpers
+// of ExcelExtractor, never through a concrete file format.
 type ValueExtractor interface {
 	Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error)
 }
@@ -170,81 +207,156 @@ type ValueExtractor interface {
 // Implement different extractors for different types of fields
 type SimpleValueExtractor struct{}
 type BoolCheckBoxExtractor struct{}
-type DualColumnClfExtractor struct{}
-type TriColumnClfExtractor struct{}
+type OptionGroupExtractor struct{}
 type BoolContainsImageExtractor struct{}
 
 func (s *SimpleValueExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
-	adjacentRange := getAdjacentRange(cellRange, criteria.Offset)
-	return e.GetCellValue(adjacentRange, sheetName)
-}
-
-func (c *BoolCheckBoxExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
-	cell := getAdjacentRange(cellRange, criteria.BoolClfCriteria.Offset).StartCell
-	return e.isCheckBoxChecked(sheetName, cell, criteria.BoolClfCriteria.SearchTerms)
-}
-
-func (c *BoolContainsImageExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
-	cell := getAdjacentRange(cellRange, criteria.BoolClfContainsImage.Offset).StartCell
-	return e.doesContainImage(sheetName, cell)
-}
-
-func (d *DualColumnClfExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
-	cellType1 := getAdjacentRange(cellRange, criteria.DualColumnClfCriteria.TYPE_1.Offset).StartCell
-	cellType2 := getAdjacentRange(cellRange, criteria.DualColumnClfCriteria.TYPE_2.Offset).StartCell
-	// fmt.Println("cellType1", cellType1, " cellType2", cellType2)
-
-	isType1, err := e.isCheckBoxChecked(sheetName, cellType1, criteria.DualColumnClfCriteria.TYPE_1.SearchTerms)
+	adjacentRange, err := getAdjacentRange(cellRange, criteria.Offset, criteria.RowOffset)
 	if err != nil {
-		fmt.Printf("Error checking %s classification: %v\n", criteria.DualColumnClfCriteria.TYPE_1.Label, err)
 		return "", err
 	}
 
-	isType2, err := e.isCheckBoxChecked(sheetName, cellType2, criteria.DualColumnClfCriteria.TYPE_2.SearchTerms)
+	rawValue, sourceCell, err := e.readCell(sheetName, adjacentRange.StartCell)
 	if err != nil {
-		fmt.Printf("Error checking %s classification: %v\n", criteria.DualColumnClfCriteria.TYPE_2.Label, err)
 		return "", err
 	}
 
-	if isType1 && !isType2 {
-		return criteria.DualColumnClfCriteria.TYPE_1.Label, nil
-	} else if !isType1 && isType2 {
-		return criteria.DualColumnClfCriteria.TYPE_2.Label, nil
+	result := FieldValue{
+		Value:      strings.TrimSpace(rawValue),
+		ValueCells: []string{adjacentRange.StartCell},
+		RawValue:   rawValue,
 	}
-	return "", nil
+	if sourceCell != adjacentRange.StartCell {
+		result.ValueCells = append(result.ValueCells, sourceCell)
+		result.Fallbacks = append(result.Fallbacks, FallbackMergedCell)
+	}
+	return result, nil
 }
 
-func (d *TriColumnClfExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
-	cellType1 := getAdjacentRange(cellRange, criteria.TriColumnClfCriteria.TYPE_1.Offset).StartCell
-	cellType2 := getAdjacentRange(cellRange, criteria.TriColumnClfCriteria.TYPE_2.Offset).StartCell
-	cellType3 := getAdjacentRange(cellRange, criteria.TriColumnClfCriteria.TYPE_3.Offset).StartCell
-
-	isType1, err := e.isCheckBoxChecked(sheetName, cellType1, criteria.TriColumnClfCriteria.TYPE_1.SearchTerms)
+func (c *BoolCheckBoxExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
+	adjacentRange, err := getAdjacentRange(cellRange, criteria.BoolClfCriteria.Offset, criteria.BoolClfCriteria.RowOffset)
 	if err != nil {
-		fmt.Printf("Error checking %s classification: %v\n", criteria.TriColumnClfCriteria.TYPE_1.Label, err)
-		return "", err
+		return false, err
 	}
 
-	isType2, err := e.isCheckBoxChecked(sheetName, cellType2, criteria.TriColumnClfCriteria.TYPE_2.SearchTerms)
+	match, err := e.isCheckBoxChecked(sheetName, adjacentRange.StartCell, criteria.BoolClfCriteria.SearchTerms, nil, e.checkBoxTolerance(criteria))
 	if err != nil {
-		fmt.Printf("Error checking %s classification: %v\n", criteria.TriColumnClfCriteria.TYPE_2.Label, err)
-		return "", err
+		return false, err
+	}
+	return FieldValue{
+		Value:      match.Checked,
+		ValueCells: []string{adjacentRange.StartCell},
+		RawValue:   match.CellText,
+		Matches:    []CheckBoxMatch{match},
+		Fallbacks:  checkBoxFallbacks(match),
+	}, nil
+}
+
+func (c *BoolContainsImageExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
+	adjacentRange, err := getAdjacentRange(cellRange, criteria.BoolClfContainsImage.Offset, criteria.BoolClfContainsImage.RowOffset)
+	if err != nil {
+		return false, err
 	}
 
-	isType3, err := e.isCheckBoxChecked(sheetName, cellType3, criteria.TriColumnClfCriteria.TYPE_3.SearchTerms)
+	containsImage, err := e.doesContainImage(sheetName, adjacentRange.StartCell)
 	if err != nil {
-		fmt.Printf("Error checking %s classification: %v\n", criteria.TriColumnClfCriteria.TYPE_3.Label, err)
-		return "", err
+		return false, err
 	}
+	return FieldValue{
+		Value:      containsImage,
+		ValueCells: []string{adjacentRange.StartCell},
+	}, nil
+}
 
-	if isType1 && !isType2 && !isType3 {
-		return criteria.TriColumnClfCriteria.TYPE_1.Label, nil
-	} else if !isType1 && isType2 && !isType3 {
-		return criteria.TriColumnClfCriteria.TYPE_2.Label, nil
-	} else if !isType1 && !isType2 && isType3 {
-		return criteria.TriColumnClfCriteria.TYPE_3.Label, nil
+// Extract looks up the checkbox of every option and returns the selected
+// label, or a "none", "conflict" or "undecidable" OptionResult
+func (o *OptionGroupExtractor) Extract(e *ExcelExtractor, sheetName string, criteria SearchCriteria, cellRange CellRange) (interface{}, error) {
+	result := OptionResult{SheetName: sheetName}
+	fieldValue := FieldValue{}
+	var checked, undecidable []string
+
+	cells := make([]string, len(criteria.Options))
+	for i, option := range criteria.Options {
+		cell, err := classificationCell(cellRange, option)
+		if err != nil {
+			return result, err
+		}
+		cells[i] = cell
+	}
+
+	for i, option := range criteria.Options {
+		// options sharing the cell, a typed mark must name its option
+		var otherTexts []string
+		for j, other := range criteria.Options {
+			if j != i && cells[j] == cells[i] {
+				otherTexts = append(otherTexts, other.SearchTerms...)
+			}
+		}
+
+		match, err := e.isCheckBoxChecked(sheetName, cells[i], option.SearchTerms, otherTexts, e.checkBoxTolerance(criteria))
+		if err != nil {
+			return result, fmt.Errorf("failed checking %s option: %w", option.Label, err)
+		}
+		match.Option = option.Label
+		result.Matches = append(result.Matches, match)
+		fieldValue.ValueCells = appendMissing(fieldValue.ValueCells, cells[i])
+		fieldValue.Fallbacks = appendMissing(fieldValue.Fallbacks, checkBoxFallbacks(match)...)
+
+		switch {
+		case match.Checked:
+			checked = append(checked, option.Label)
+		case match.Undecidable:
+			undecidable = append(undecidable, option.Label)
+		}
+	}
+
+	switch {
+	case len(undecidable) > 0:
+		result.Status = OptionUndecidable
+		result.Options = append(checked, undecidable...)
+	case len(checked) == 0:
+		result.Status = OptionNone
+		for _, option := range criteria.Options {
+			result.Options = append(result.Options, option.Label)
+		}
+	case len(checked) == 1:
+		result.Status = OptionSelected
+		result.Selected = checked[0]
+	default:
+		result.Status = OptionConflict
+		result.Options = checked
+	}
+
+	fieldValue.Value = result.Selected
+	fieldValue.Matches = result.Matches
+	fieldValue.Option = &result
+	return fieldValue, nil
+}
+
+// appendMissing appends the values not yet in the slice
+func appendMissing(values []string, newValues ...string) []string {
+	for _, newValue := range newValues {
+		found := false
+		for _, value := range values {
+			if value == newValue {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, newValue)
+		}
 	}
-	return "", nil
+	return values
+}
+
+// classificationCell returns the cell holding the checkbox of one classification
+func classificationCell(cellRange CellRange, criteria ClassificationCriteria) (string, error) {
+	adjacentRange, err := getAdjacentRange(cellRange, criteria.Offset, criteria.RowOffset)
+	if err != nil {
+		return "", fmt.Errorf("invalid cell for %s classification: %w", criteria.Label, err)
+	}
+	return adjacentRange.StartCell, nil
 }
 
 // ///////////////////////////////
@@ -253,6 +365,10 @@ func (d *TriColumnClfExtractor) Extract(e *ExcelExtractor, sheetName string, cri
 
 // Helper function to set values using reflection
 func setValue(field reflect.Value, value interface{}) {
+	if result, ok := value.(FieldValue); ok {
+		value = result.Value
+	}
+
 	switch field.Kind() {
 	case reflect.String:
 		field.SetString(value.(string))
@@ -276,21 +392,176 @@ func (e *ExcelExtractor) ReplaceCompanyNames(items []string) []string {
 	return results
 }
 
+// MakeSECCFExtractor opens a SECCF workbook using the built-in template
 func MakeSECCFExtractor(filePath string, companyNames CompanyNameList) (*ExcelExtractor, error) {
-	f, err := excelize.OpenFile(filePath)
+	return MakeTemplateExtractor(filePath, companyNames, DefaultSECCFTemplate())
+}
+
+// MakeSECCFExtractorWithOptions opens a SECCF workbook using the built-in
+// template and the given options
+func MakeSECCFExtractorWithOptions(filePath string, companyNames CompanyNameList, options *OpenOptions) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorWithOptions(filePath, companyNames, DefaultSECCFTemplate(), options)
+}
+
+// MakeSECCFExtractorFromReader reads a SECCF workbook from r using the
+// built-in template
+func MakeSECCFExtractorFromReader(r io.Reader, companyNames CompanyNameList) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromReader(r, companyNames, DefaultSECCFTemplate())
+}
+
+// MakeSECCFExtractorFromBytes reads a SECCF workbook held in memory using the
+// built-in template
+func MakeSECCFExtractorFromBytes(data []byte, companyNames CompanyNameList) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromBytes(data, companyNames, DefaultSECCFTemplate())
+}
+
+// MakeTemplateExtractor opens a workbook that is extracted with the given
+// template
+func MakeTemplateExtractor(filePath string, companyNames CompanyNameList, template *FormTemplate) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorWithOptions(filePath, companyNames, template, nil)
+}
+
+// MakeTemplateExtractorWithOptions opens a workbook, e.g. an encrypted one
+// with the passwords of the options
+func MakeTemplateExtractorWithOptions(filePath string, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorContext(context.Background(), filePath, companyNames, template, options)
+}
+
+// MakeSECCFExtractorContext opens a SECCF workbook using the built-in
+// template. ctx is also the context of Extract and ExtractWithError.
+func MakeSECCFExtractorContext(ctx context.Context, filePath string, companyNames CompanyNameList, options *OpenOptions) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorContext(ctx, filePath, companyNames, DefaultSECCFTemplate(), options)
+}
+
+// MakeTemplateExtractorContext opens a workbook with the given options.
+// ctx is also the context of Extract and ExtractWithError.
+func MakeTemplateExtractorContext(ctx context.Context, filePath string, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	// an oversized file is not read at all
+	if info, err := os.Stat(filePath); err == nil {
+		if err := checkLimit(LimitFileSize, info.Size(), options.limits().MaxFileSize); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open Excel file: %w", err)
 	}
+	return MakeTemplateExtractorFromBytesContext(ctx, data, companyNames, template, options)
+}
+
+// MakeTemplateExtractorFromReader reads a whole workbook from r, e.g. an
+// upload or an email attachment, without going through a file
+func MakeTemplateExtractorFromReader(r io.Reader, companyNames CompanyNameList, template *FormTemplate) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromReaderWithOptions(r, companyNames, template, nil)
+}
 
+// MakeTemplateExtractorFromReaderWithOptions reads a whole workbook from r
+// and opens it with the given options
+func MakeTemplateExtractorFromReaderWithOptions(r io.Reader, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromReaderContext(context.Background(), r, companyNames, template, options)
+}
+
+// MakeTemplateExtractorFromReaderContext reads a whole workbook from r, at
+// most the MaxFileSize of the options, and opens it as
+// MakeTemplateExtractorFromBytesContext does
+func MakeTemplateExtractorFromReaderContext(ctx context.Context, r io.Reader, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	data, err := options.limits().readLimited(r)
+	if err != nil {
+		if _, ok := err.(LimitExceededError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read Excel file: %w", err)
+	}
+	return MakeTemplateExtractorFromBytesContext(ctx, data, companyNames, template, options)
+}
+
+// MakeTemplateExtractorFromBytes reads a workbook held in memory
+func MakeTemplateExtractorFromBytes(data []byte, companyNames CompanyNameList, template *FormTemplate) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromBytesWithOptions(data, companyNames, template, nil)
+}
+
+// MakeTemplateExtractorFromBytesWithOptions reads a workbook held in memory
+// and opens it with the given options. Encrypted workbooks fail with
+// PasswordRequiredError or WrongPasswordError, workbooks over the limits of
+// the options with LimitExceededError.
+func MakeTemplateExtractorFromBytesWithOptions(data []byte, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	return MakeTemplateExtractorFromBytesContext(context.Background(), data, companyNames, template, options)
+}
+
+// MakeTemplateExtractorFromBytesContext reads a workbook held in memory and
+// opens it with the given options. ctx is checked before and after opening,
+// which itself cannot be interrupted, and fails with a CanceledError once
+// done. It is also the context of Extract and ExtractWithError.
+func MakeTemplateExtractorFromBytesContext(ctx context.Context, data []byte, companyNames CompanyNameList, template *FormTemplate, options *OpenOptions) (*ExcelExtractor, error) {
+	if err := checkTemplate(template); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, CanceledError{err: err}
+	}
+
+	workbook, err := openWorkbook(data, options)
+	if err != nil {
+		switch err.(type) {
+		case PasswordRequiredError, WrongPasswordError, LimitExceededError:
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to open Excel file: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		workbook.Close()
+		return nil, CanceledError{err: err}
+	}
+
+	e := newExcelExtractor(workbook, companyNames, template)
+	e.ctx = ctx
+	return e, nil
+}
+
+// MakeTemplateExtractorFromWorkbook extracts a workbook that is already
+// open, e.g. a MemoryWorkbook built by a test or another Workbook
+// implementation
+func MakeTemplateExtractorFromWorkbook(workbook Workbook, companyNames CompanyNameList, template *FormTemplate) (*ExcelExtractor, error) {
+	if workbook == nil {
+		return nil, fmt.Errorf("workbook is required")
+	}
+	if err := checkTemplate(template); err != nil {
+		return nil, err
+	}
+	return newExcelExtractor(workbook, companyNames, template), nil
+}
+
+func checkTemplate(template *FormTemplate) error {
+	if template == nil {
+		return fmt.Errorf("template is required")
+	}
+	return template.Validate()
+}
+
+func newExcelExtractor(workbook Workbook, companyNames CompanyNameList, template *FormTemplate) *ExcelExtractor {
 	return &ExcelExtractor{
-		file:         f,
+		workbook:     workbook,
 		companyNames: companyNames,
+		template:     template,
+		ctx:          context.Background(),
+		sheets:       newSheetCache(),
 		Extraction:   &SECCFExtraction{},
-	}, nil
+	}
+}
+
+// MakeTemplateExtractorFromFile opens a workbook that is extracted with the
+// template stored at templatePath
+func MakeTemplateExtractorFromFile(filePath string, companyNames CompanyNameList, templatePath string) (*ExcelExtractor, error) {
+	template, err := LoadTemplate(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	return MakeTemplateExtractor(filePath, companyNames, template)
 }
 
 func (e *ExcelExtractor) searchSheetName(searchWord string) (bool, string, error) {
-	sheetList := e.file.GetSheetList()
+	sheetList := e.workbook.SheetNames()
 
 	wordFound := false
 	foundSheetName := ""
@@ -311,764 +582,403 @@ func (e *ExcelExtractor) searchSheetName(searchWord string) (bool, string, error
 }
 
 func (e *ExcelExtractor) GetCellValue(cellRange CellRange, sheetName string) (string, error) {
+	value, _, err := e.readCell(sheetName, cellRange.StartCell)
+	return strings.TrimSpace(value), err
+}
+
+// readCell returns the untrimmed value of a cell together with the cell it was
+// read from, which is the top-left cell of the merged range for an empty cell
+// inside a merge
+func (e *ExcelExtractor) readCell(sheetName string, cell string) (string, string, error) {
 	// First try getting the value from the start cell
-	value, err := e.file.GetCellValue(sheetName, cellRange.StartCell)
+	snapshot, err := e.getSnapshot(sheetName)
+	if err != nil {
+		return "", cell, fmt.Errorf("failed to get cell value: %w", err)
+	}
+	value, err := snapshot.cellValue(cell)
 	if err != nil {
-		return "", fmt.Errorf("failed to get cell value: %w", err)
+		return "", cell, fmt.Errorf("failed to get cell value: %w", err)
 	}
 
 	// If we got a value, return it
 	if value != "" {
-		return strings.TrimSpace(value), nil
+		return value, cell, nil
 	}
 
 	// If no value in start cell, check if it's part of a merged range
-	mergedCells, err := e.file.GetMergeCells(sheetName)
+	mergedRange, found, err := e.GetMergedRange(sheetName, cell)
 	if err != nil {
-		return "", fmt.Errorf("failed to get merged cells: %w", err)
+		return "", cell, err
 	}
-
-	// Check each merged range
-	for _, mergedCell := range mergedCells {
-		if e.isCellInRange(cellRange.StartCell, &mergedCell) {
-			// fmt.Printf("Cellvalue: %s\n", strings.TrimSpace(mergedCell.GetCellValue()))
-			return strings.TrimSpace(mergedCell.GetCellValue()), nil
-		}
+	if found {
+		return mergedRange.Value, mergedRange.StartCell, nil
 	}
 
-	return "", nil
+	return "", cell, nil
 }
 
-// isCellInRange checks if a cell is within a merged cell range
-func (e *ExcelExtractor) isCellInRange(cell string, mergedCell *excelize.MergeCell) bool {
-	return strings.HasPrefix(mergedCell.GetStartAxis(), cell) ||
-		strings.HasPrefix(cell, mergedCell.GetStartAxis())
+// ToJson returns the extraction as JSON. The provenance of every field is
+// only included when IncludeProvenance is set.
+func (e *ExcelExtractor) ToJson() (string, error) {
+	extraction := *e.Extraction
+	if !e.IncludeProvenance {
+		extraction.Provenance = nil
+	}
+
+	jsonBytes, err := json.Marshal(extraction)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode extraction: %w", err)
+	}
+	return string(jsonBytes), nil
 }
 
-// getAdjacentRange returns the adjacent cell range
-func getAdjacentRange(cellRange CellRange, offset int) CellRange {
-	// Parse the column and row from StartCell
-	startCol := strings.Split(cellRange.StartCell, "")[0]
-	startRow := strings.Split(cellRange.StartCell, "")[1:]
+func (e *ExcelExtractor) extractControlledContent(sheetName string, columnMappings []ColumnMapping, headerScanRows int) ([]ControlCotent, *HeaderMatch) {
+	var contents []ControlCotent
 
-	// Parse the column and row from EndCell
-	endCol := strings.Split(cellRange.EndCell, "")[0]
-	endRow := strings.Split(cellRange.EndCell, "")[1:]
+	// Problems are recorded as diagnostics
+	header, _ := e.streamControlledContent(sheetName, columnMappings, headerScanRows, func(content ControlCotent) error {
+		contents = append(contents, content)
+		return nil
+	})
+	return contents, header
+}
 
-	// Calculate new columns (offset to the right)
-	newStartCol := string(rune(startCol[0] + byte(offset)))
-	newEndCol := string(rune(endCol[0] + byte(offset)))
+func (e *ExcelExtractor) extractDetails(details interface{}, section string, sheetName string, criteria map[string]SearchCriteria) {
+	// Get the reflect.Value of the pointer to the struct
+	detailsValue := reflect.ValueOf(details).Elem()
 
-	return CellRange{
-		StartCell: newStartCol + strings.Join(startRow, ""),
-		EndCell:   newEndCol + strings.Join(endRow, ""),
+	// Walk the fields in a stable order
+	fieldNames := make([]string, 0, len(criteria))
+	for fieldName := range criteria {
+		fieldNames = append(fieldNames, fieldName)
 	}
-}
+	sort.Strings(fieldNames)
 
-func (e *ExcelExtractor) ToJson() string {
-	jsonBytes, err := json.Marshal(e.Extraction)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return string("{}")
+	// A failing field is reported and the remaining fields are still extracted
+	for _, fieldName := range fieldNames {
+		if e.checkContext(section) != nil {
+			return
+		}
+		e.extractDetailField(detailsValue, section, sheetName, fieldName, criteria[fieldName])
 	}
-	return string(jsonBytes)
 }
 
-func (e *ExcelExtractor) findHeaderRow(sheetName string, columnMappings []ColumnMapping) (int, error) {
-	// Look for headers between rows 10-12
-	for row := 10; row <= 12; row++ {
-		// Check if this row contains known headers
-		for _, mapping := range columnMappings {
-			for _, term := range mapping.SearchTerms {
-				value, _ := e.file.GetCellValue(sheetName, fmt.Sprintf("A%d", row))
-				if strings.Contains(strings.ToLower(value), strings.ToLower(term)) {
-					return row, nil
-				}
-			}
+// extractDetailField looks up the label of one field and extracts its value.
+// Problems, including panics on malformed cell references, are recorded as
+// diagnostics.
+func (e *ExcelExtractor) extractDetailField(detailsValue reflect.Value, section string, sheetName string, fieldName string, searchCriteria SearchCriteria) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.errorf(DiagnosticExtractorFailed, section, fieldName, sheetName, "", "panic extracting value: %v", r)
 		}
-	}
-	return 11, fmt.Errorf("header row not found")
-}
+	}()
 
-func (e *ExcelExtractor) findColumnByHeader(sheetName string, headerRow int, searchTerms []string) (string, error) {
-	// Get all cells in the header row
-	cols, err := e.file.GetCols(sheetName)
-	if err != nil {
-		return "", fmt.Errorf("failed to get columns: %w", err)
-	}
+	keyCellFound := false
+	for i, cellRange := range searchCriteria.CellRanges {
+		// Get 'KEY' cell from the potential label cell
+		value, err := e.GetCellValue(cellRange, sheetName)
+		if err != nil {
+			e.errorf(DiagnosticExtractorFailed, section, fieldName, sheetName, cellRange.StartCell, "failed to read label cell: %v", err)
+			return
+		}
 
-	// Look through each column
-	for colIdx, col := range cols {
-		if len(col) >= headerRow {
-			headerCell := utils.RemoveExtraSpaces(strings.TrimSpace(strings.ToLower(col[headerRow-1])))
-			// Check if any search term matches
-			for _, term := range searchTerms {
-				termLower := utils.RemoveExtraSpaces(strings.ToLower(term))
-				if strings.Contains(headerCell, termLower) {
-					// Convert column index to letter (0 = A, 1 = B, etc.)
-					colName, err := excelize.ColumnNumberToName(colIdx + 1)
-					fmt.Println("Found colName:", colName, "for term:", term, "headerCell: ", headerCell)
-					if err != nil {
-						return "", err
-					}
-					return colName, nil
+		// Check if the 'KEY' Cell value matches any of our search terms
+		for _, searchTerm := range searchCriteria.SearchTerms {
+			if matchesSearchTerm(value, searchTerm) {
+				keyCellFound = true
+				provenance := FieldProvenance{Section: section, Field: fieldName, SheetName: sheetName, LabelCell: cellRange.StartCell, LabelText: value}
+				if i > 0 {
+					provenance.Fallbacks = append(provenance.Fallbacks, FallbackAlternateCellRange)
+				}
+				if err := e.extractField(detailsValue, provenance, searchCriteria, cellRange); err != nil {
+					e.errorf(DiagnosticExtractorFailed, section, fieldName, sheetName, cellRange.StartCell, "error extracting value: %v", err)
+					return
 				}
+				break
 			}
 		}
 	}
-	return "", fmt.Errorf("column not found for search terms: %v", searchTerms)
-}
 
-func (e *ExcelExtractor) extractControlledContent(sheetName string, columnMappings []ColumnMapping) []ControlCotent {
-	var contents []ControlCotent
-
-	// Find the header row (assuming it's around row 10-12)
-	// headerRow := 11 // You might want to make this dynamic too
-	headerRow, _ := e.findHeaderRow(sheetName, columnMappings) // default to 11
-
-	// Find actual columns for each mapping
-	for i := range columnMappings {
-		col, err := e.findColumnByHeader(sheetName, headerRow, columnMappings[i].SearchTerms)
+	// The fixed cell ranges are only hints, fall back to scanning the sheet for the label
+	if !keyCellFound && searchCriteria.LabelSearch {
+		labelCell, found, err := e.findLabelCell(sheetName, searchCriteria.SearchTerms, searchCriteria.SearchRegion)
 		if err != nil {
-			fmt.Printf("Warning: Could not find column for %s: %v\n", columnMappings[i].FieldName, err)
-			continue
+			e.errorf(DiagnosticExtractorFailed, section, fieldName, sheetName, "", "error searching label for %s: %v", fieldName, err)
+			return
 		}
-		columnMappings[i].FoundColumn = col
-	}
-
-	// Start from the row after header
-	row := headerRow + 1
-	for {
-		// Check if row is empty (using first column as indicator)
-		if len(columnMappings) == 0 || columnMappings[0].FoundColumn == "" {
-			break
+		if found {
+			keyCellFound = true
+			cellRange := CellRange{StartCell: labelCell, EndCell: labelCell}
+			labelText, _ := e.GetCellValue(cellRange, sheetName)
+			provenance := FieldProvenance{Section: section, Field: fieldName, SheetName: sheetName, LabelCell: labelCell, LabelText: labelText, Fallbacks: []string{FallbackLabelSearch}}
+			if err := e.extractField(detailsValue, provenance, searchCriteria, cellRange); err != nil {
+				e.errorf(DiagnosticExtractorFailed, section, fieldName, sheetName, labelCell, "error extracting value: %v", err)
+				return
+			}
 		}
+	}
 
-		firstCellValue, _ := e.file.GetCellValue(sheetName, fmt.Sprintf("%s%d", columnMappings[0].FoundColumn, row))
-		if firstCellValue == "" {
-			break
-		}
+	if !keyCellFound {
+		e.warnf(DiagnosticFieldNotFound, section, fieldName, sheetName, "", "field %s not found in excel", fieldName)
+	}
+}
 
-		content := ControlCotent{
-			SheetName: sheetName,
-		}
+// extractField reads the value belonging to the label found at cellRange,
+// sets it on the details struct and records its provenance
+func (e *ExcelExtractor) extractField(detailsValue reflect.Value, provenance FieldProvenance, searchCriteria SearchCriteria, cellRange CellRange) error {
+	var extractor ValueExtractor
 
-		// Use reflection to set fields dynamically
-		contentValue := reflect.ValueOf(&content).Elem()
+	// Select appropriate extractor based on criteria type
+	if len(searchCriteria.Options) > 0 {
+		extractor = &OptionGroupExtractor{}
+	} else if searchCriteria.BoolCheckBox {
+		extractor = &BoolCheckBoxExtractor{}
+	} else if searchCriteria.BoolContainsImage {
+		extractor = &BoolContainsImageExtractor{}
+	} else {
+		extractor = &SimpleValueExtractor{}
+	}
+	provenance.Extractor = reflect.TypeOf(extractor).Elem().Name()
 
-		for _, mapping := range columnMappings {
-			if mapping.FoundColumn == "" {
-				continue
-			}
+	// Extract the value
+	extractedValue, err := extractor.Extract(e, provenance.SheetName, searchCriteria, cellRange)
+	if err != nil {
+		return err
+	}
 
-			cellValue, _ := e.file.GetCellValue(sheetName, fmt.Sprintf("%s%d", mapping.FoundColumn, row))
-			field := contentValue.FieldByName(mapping.FieldName)
+	if result, ok := extractedValue.(FieldValue); ok {
+		provenance.ValueCells = result.ValueCells
+		provenance.RawValue = result.RawValue
+		provenance.Fallbacks = appendMissing(provenance.Fallbacks, result.Fallbacks...)
 
-			if field.IsValid() && field.CanSet() {
-				field.SetString(strings.TrimSpace(cellValue))
+		// Keep track of the checkboxes the value was decided from
+		for _, match := range result.Matches {
+			match.Field = provenance.Field
+			provenance.Controls = append(provenance.Controls, match)
+			e.Extraction.CheckBoxMatches = append(e.Extraction.CheckBoxMatches, match)
+			if match.LinkError != "" {
+				e.warnf(DiagnosticLinkedCellBroken, provenance.Section, provenance.Field, match.SheetName, match.ControlCell, "checkbox linked to %s, which cannot be read, keeps its own state: %s", match.LinkedCell, match.LinkError)
 			}
 		}
+		if result.Option != nil {
+			option := *result.Option
+			option.Field = provenance.Field
+			e.Extraction.OptionResults = append(e.Extraction.OptionResults, option)
+		}
+	}
+	e.recordProvenance(provenance)
 
-		contents = append(contents, content)
-		row++
+	// Set the field using reflection
+	field := detailsValue.FieldByName(provenance.Field)
+	if field.IsValid() && field.CanSet() {
+		setValue(field, extractedValue)
+	} else {
+		e.errorf(DiagnosticFieldNotSettable, provenance.Section, provenance.Field, provenance.SheetName, provenance.LabelCell, "field: %s is isValid: %v and canSet: %v", provenance.Field, field.IsValid(), field.CanSet())
 	}
+	return nil
+}
 
-	return contents
+// ReadFormControls returns the form controls of the product details sheet
+//
+// Deprecated: use Inspect, which lists the form controls of every sheet.
+func (e *ExcelExtractor) ReadFormControls() ([]FormControl, error) {
+	if e.Extraction.ProductDetails == nil {
+		return nil, fmt.Errorf("product details have not been extracted")
+	}
+	return e.workbook.FormControls(e.Extraction.ProductDetails.SheetName)
 }
 
-func (e *ExcelExtractor) extractDetails(details interface{}, sheetName string, criteria map[string]SearchCriteria) {
-	// Get the reflect.Value of the pointer to the struct
-	detailsValue := reflect.ValueOf(details).Elem()
+func (e *ExcelExtractor) doesContainImage(sheetName string, cell string) (bool, error) {
+	snapshot, err := e.getSnapshot(sheetName)
+	if err != nil {
+		return false, err
+	}
+	return snapshot.pictureCells[cell], nil
+}
 
-	for fieldName, searchCriteria := range criteria {
-		keyCellFound := false
-		for _, cellRange := range searchCriteria.CellRanges {
-			// Get 'KEY' cell from the potential label cell
-			value, err := e.GetCellValue(cellRange, sheetName)
-			if err != nil {
-				fmt.Printf("Error trying to retrive cell value: %v\n", err)
-				return
-			}
+// Extract runs the template against the workbook. Problems are reported in
+// the Diagnostics of the result, use ExtractWithError to also get an error.
+func (e *ExcelExtractor) Extract() SECCFExtraction {
+	extraction, _ := e.ExtractWithError()
+	return extraction
+}
 
-			// Check if the 'KEY' Cell value matches any of our search terms
-			for _, searchTerm := range searchCriteria.SearchTerms {
-				if strings.Contains(utils.RemoveExtraSpaces(strings.ToLower(value)), utils.RemoveExtraSpaces(strings.ToLower(searchTerm))) {
-					keyCellFound = true
-					var extractor ValueExtractor
-
-					// Select appropriate extractor based on criteria type
-					if searchCriteria.DualColumnCheckBoxClf {
-						extractor = &DualColumnClfExtractor{}
-					} else if searchCriteria.TriColumnCheckBoxClf {
-						extractor = &TriColumnClfExtractor{}
-					} else if searchCriteria.BoolCheckBox {
-						extractor = &BoolCheckBoxExtractor{}
-					} else if searchCriteria.BoolContainsImage {
-						extractor = &BoolContainsImageExtractor{}
-					} else {
-						extractor = &SimpleValueExtractor{}
-					}
-
-					// Extract the value
-					extractedValue, err := extractor.Extract(e, sheetName, searchCriteria, cellRange)
-					if err != nil {
-						fmt.Println("error extracting value: %w", err)
-						return
-					}
-
-					// Set the field using reflection
-					field := detailsValue.FieldByName(fieldName)
-					if field.IsValid() && field.CanSet() {
-						setValue(field, extractedValue)
-					} else {
-						fmt.Printf("field: %s is isValid: %v and canSet: %v\n", fieldName, field.IsValid(), field.CanSet())
-					}
-
-					break
-				}
-			}
-		}
-		if !keyCellFound {
-			fmt.Printf("Field %s not found in excel\n", fieldName)
-		}
-	}
+// ExtractWithError runs the template against the workbook and returns the
+// partial result together with an *ExtractionError naming every section that
+// failed. A failing field or section does not stop the others.
+func (e *ExcelExtractor) ExtractWithError() (SECCFExtraction, error) {
+	return e.ExtractContext(e.ctx)
 }
 
-func (e *ExcelExtractor) ReadFormControls() {
-	sheetName := e.Extraction.ProductDetails.SheetName
-	formControls, err := e.file.GetFormControls(sheetName) // sheet name
-	if err != nil {
-		fmt.Println(err)
-		return
+// ExtractContext is ExtractWithError stopping once ctx is canceled or its
+// deadline passes. Cancellation is checked between sections, fields and
+// table rows, and returns a CanceledError with what was extracted until then.
+// A sheet over the rows limit fails with a LimitExceededError instead of an
+// *ExtractionError.
+func (e *ExcelExtractor) ExtractContext(ctx context.Context) (SECCFExtraction, error) {
+	previous := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = previous }()
+
+	// Results of an earlier run are replaced, a section not reached this time
+	// is left empty
+	*e.Extraction = SECCFExtraction{}
+	e.limitErr = nil
+	if len(e.companyNames) == 0 && e.template.UsesCompanyNames() {
+		e.warnf(DiagnosticNoCompanyNames, "", "", "", "", "template %s searches for %s but no company names were given, those search terms are skipped", e.template.Name, companyNamePlaceholder)
 	}
 
-	for _, control := range formControls {
-		fmt.Printf("[%s] Control Cell %s, Control checked: %v, control.Paragraph %v, control.CurrentVal %v, cellLink: %s, offsetX: %v, offsetY: %v, Control cell text: %s\n", sheetName, control.Cell, control.Checked, control.Paragraph, control.CurrentVal, control.CellLink, control.Format.OffsetX, control.Format.OffsetY, control.Text)
+	extract := e.extractParallel
+	if e.Sequential || len(e.template.Sections) < 2 {
+		extract = e.extractSequential
+	}
+	if err := extract(); err != nil {
+		return *e.Extraction, err
+	}
 
-		// if control.Type == excelize.FormControlCheckBox {
-		// }
+	// a sheet over a limit fails its sections, the other sections are kept
+	if e.limitErr != nil {
+		return *e.Extraction, e.limitErr
 	}
+	return *e.Extraction, newExtractionError(e.template.Sections, e.Extraction.Diagnostics)
 }
 
-func (e *ExcelExtractor) isCheckBoxChecked(sheetName string, cell string, classificationTexts []string) (bool, error) {
-	formControls, err := e.file.GetFormControls(sheetName)
-	if err != nil {
-		return false, fmt.Errorf("failed to get form controls: %w", err)
+// extractSequential extracts the sections in template order, up to the one
+// during which the context is done
+func (e *ExcelExtractor) extractSequential() error {
+	for _, section := range e.template.Sections {
+		if err := e.checkContext(section.Name); err != nil {
+			e.errorf(DiagnosticCanceled, section.Name, "", "", "", "%v", err)
+			return err
+		}
+		e.extractSection(section)
+		// the section may have stopped early
+		if err := e.checkContext(section.Name); err != nil {
+			e.errorf(DiagnosticCanceled, section.Name, "", "", "", "%v", err)
+			return err
+		}
 	}
-
-	for _, control := range formControls {
-		if control.Cell == cell {
-			if control.Type == excelize.FormControlCheckBox {
-				for _, text := range classificationTexts {
-					for _, paraText := range control.Paragraph {
-						if strings.EqualFold(paraText.Text, text) {
-							// fmt.Printf("[%s] Control Cell %s, Control checked: %v control.Paragraph %v, Control cell text: %s, cell %s\n", sheetName, control.Cell, control.Checked, control.Paragraph, control.Text, cell)
-							return control.Checked, nil
-						}
-					}
-				}
+	return nil
+}
+
+// extractParallel extracts every section on its own goroutine into its own
+// extraction. They are merged in template order, so the result is the one of
+// extractSequential. When the context is done, the first section it stopped
+// is reported, along with whatever the others extracted.
+func (e *ExcelExtractor) extractParallel() error {
+	sections := e.template.Sections
+	extractors := make([]*ExcelExtractor, len(sections))
+	canceled := make([]error, len(sections))
+
+	var wg sync.WaitGroup
+	for i, section := range sections {
+		extractors[i] = e.sectionExtractor()
+		wg.Add(1)
+		go func(i int, section SectionTemplate) {
+			defer wg.Done()
+			if canceled[i] = extractors[i].checkContext(section.Name); canceled[i] != nil {
+				return
 			}
+			extractors[i].extractSection(section)
+			canceled[i] = extractors[i].checkContext(section.Name)
+		}(i, section)
+	}
+	wg.Wait()
+
+	var err error
+	for i, section := range sections {
+		e.mergeSection(section, extractors[i])
+		if canceled[i] != nil && err == nil {
+			e.errorf(DiagnosticCanceled, section.Name, "", "", "", "%v", canceled[i])
+			err = canceled[i]
 		}
 	}
-	return false, nil
+	return err
 }
 
-func (e *ExcelExtractor) doesContainImage(sheetName string, cell string) (bool, error) {
-	images, err := e.file.GetPictures(sheetName, cell)
-	// fmt.Printf("images: %v cell %s\n", images, cell)
-	if err != nil {
-		return false, fmt.Errorf("failed to get form controls: %w", err)
-	}
-
-	if len(images) == 0 {
-		return false, nil
+// sectionExtractor returns an extractor for one section extracted next to
+// the others. It shares the workbook and the sheets read, its results are
+// its own.
+func (e *ExcelExtractor) sectionExtractor() *ExcelExtractor {
+	return &ExcelExtractor{
+		workbook:     e.workbook,
+		companyNames: e.companyNames,
+		template:     e.template,
+		ctx:          e.ctx,
+		sheets:       e.sheets,
+		Extraction:   &SECCFExtraction{},
 	}
-	return true, nil
 }
 
-func (e *ExcelExtractor) Extract() SECCFExtraction {
-	_, buyerSheetName, err := e.searchSheetName("buyer details")
-
-	buyerDetailsCriteria := map[string]SearchCriteria{
-		"PartNumber": {
-			SearchTerms: []string{"part number", "part-nr", "part_number"},
-			CellRanges: []CellRange{
-				{StartCell: "B12", EndCell: "D12"},
-			},
-			Offset: 3,
-		},
-		"PartDescription": {
-			SearchTerms: []string{"description", "desc", "part description"},
-			CellRanges: []CellRange{
-				{StartCell: "B13", EndCell: "D13"},
-			},
-			Offset: 3,
-		},
-		"ControlListClassificationNumber": {
-			SearchTerms: []string{"control list classification number"},
-			CellRanges: []CellRange{
-				{StartCell: "B18", EndCell: "D18"},
-			},
-			Offset: 3,
-		},
-		"RFQ": {
-			SearchTerms: []string{"RQF", "quote reference"},
-			CellRanges: []CellRange{
-				{StartCell: "B19", EndCell: "D19"},
-			},
-			Offset: 3,
-		},
-		"BuildToPrint": {
-			SearchTerms: []string{"Build To Print"},
-			CellRanges: []CellRange{
-				{StartCell: "B21", EndCell: "F21"},
-			},
-			BoolCheckBox: true,
-			BoolClfCriteria: BoolClassificationCriteria{
-				Offset:      5,
-				SearchTerms: []string{"YES"},
-			},
-		},
-		"ManufacturedToSpecification": {
-			SearchTerms: []string{"Manufactured to specification", "(MTS)"},
-			CellRanges: []CellRange{
-				{StartCell: "B22", EndCell: "F22"},
-			},
-			BoolCheckBox: true,
-			BoolClfCriteria: BoolClassificationCriteria{
-				Offset:      5,
-				SearchTerms: []string{"YES"},
-			},
-		},
-		"OriginalEquipmentManufacturer": {
-			SearchTerms: []string{"Original Equipment Manufacturer"},
-			CellRanges: []CellRange{
-				{StartCell: "B23", EndCell: "F23"},
-			},
-			BoolCheckBox: true,
-			BoolClfCriteria: BoolClassificationCriteria{
-				Offset:      5,
-				SearchTerms: []string{"YES"},
-			},
-		},
-		"Modified": {
-			SearchTerms: []string{"Modified"},
-			CellRanges: []CellRange{
-				{StartCell: "B25", EndCell: "F25"},
-			},
-			BoolCheckBox: true,
-			BoolClfCriteria: BoolClassificationCriteria{
-				Offset:      5,
-				SearchTerms: []string{"YES"},
-			},
-		},
-		"ClassificationOfItem": {
-			SearchTerms: e.ReplaceCompanyNames([]string{"{companyName} Classification of item"}),
-			CellRanges: []CellRange{
-				{StartCell: "B15", EndCell: "D15"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "DUAL",
-					SearchTerms: []string{"Dual", "DU"},
-					Offset:      3,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "MILITARY",
-					SearchTerms: []string{"Military", "MIL"},
-					Offset:      4,
-				},
-			},
-		},
+// mergeSection adds the results of a section extracted by a section
+// extractor
+func (e *ExcelExtractor) mergeSection(section SectionTemplate, s *ExcelExtractor) {
+	switch section.Name {
+	case SectionBuyerDetails:
+		e.Extraction.BuyerDetails = s.Extraction.BuyerDetails
+	case SectionProductDetails:
+		e.Extraction.ProductDetails = s.Extraction.ProductDetails
+	case SectionControlledContent:
+		e.Extraction.ControlledContent = s.Extraction.ControlledContent
+		e.Extraction.ControlledContentHeader = s.Extraction.ControlledContentHeader
 	}
 
-	if err != nil {
-		fmt.Println("%w", err)
-	} else {
-		e.Extraction.BuyerDetails = &BuyerDetails{
-			SheetName: buyerSheetName,
-		}
-		e.extractDetails(e.Extraction.BuyerDetails, buyerSheetName, buyerDetailsCriteria)
+	e.Extraction.CheckBoxMatches = append(e.Extraction.CheckBoxMatches, s.Extraction.CheckBoxMatches...)
+	e.Extraction.OptionResults = append(e.Extraction.OptionResults, s.Extraction.OptionResults...)
+	e.Extraction.Diagnostics = append(e.Extraction.Diagnostics, s.Extraction.Diagnostics...)
+	for _, provenance := range s.Extraction.Provenance {
+		e.recordProvenance(provenance)
 	}
+	e.recordLimit(s.limitErr)
+}
 
-	_, productSheetName, err_product_sheet_search := e.searchSheetName("product details")
-
-	productDetailsCriteria := map[string]SearchCriteria{
-		"SupplierPartNumber": {
-			SearchTerms: []string{"Supplier part number"},
-			CellRanges: []CellRange{
-				{StartCell: "C11", EndCell: "D11"},
-			},
-			Offset: 2,
-		},
-		"SupplierCompanyName": {
-			SearchTerms: []string{"company name"},
-			CellRanges: []CellRange{
-				{StartCell: "C12", EndCell: "C12"},
-			},
-			Offset: 1,
-		},
-		"SupplierFullAddress": {
-			SearchTerms: []string{"full address"},
-			CellRanges: []CellRange{
-				{StartCell: "C13", EndCell: "C13"},
-			},
-			Offset: 1,
-		},
-		"SupplierCountry": {
-			SearchTerms: []string{"Country"},
-			CellRanges: []CellRange{
-				{StartCell: "C14", EndCell: "C14"},
-			},
-			Offset: 1,
-		},
-		"SupplierCompanyNumber": {
-			SearchTerms: []string{"company number"},
-			CellRanges: []CellRange{
-				{StartCell: "C15", EndCell: "C15"},
-			},
-			Offset: 1,
-		},
-		"ManufacturerPartNumber": {
-			SearchTerms: []string{"manufacturer part number"},
-			CellRanges: []CellRange{
-				{StartCell: "C16", EndCell: "C116"},
-			},
-			Offset: 2,
-		},
-		"ManufacturerCompanyName": {
-			SearchTerms: []string{"company name"},
-			CellRanges: []CellRange{
-				{StartCell: "C17", EndCell: "C17"},
-			},
-			Offset: 1,
-		},
-		"ManufacturerFullAddress": {
-			SearchTerms: []string{"full address"},
-			CellRanges: []CellRange{
-				{StartCell: "C18", EndCell: "C18"},
-			},
-			Offset: 1,
-		},
-		"ManufacturerCountry": {
-			SearchTerms: []string{"Country"},
-			CellRanges: []CellRange{
-				{StartCell: "C19", EndCell: "C19"},
-			},
-			Offset: 1,
-		},
-		"ManufacturerCompanyNumber": {
-			SearchTerms: []string{"company number"},
-			CellRanges: []CellRange{
-				{StartCell: "C20", EndCell: "C20"},
-			},
-			Offset: 1,
-		},
-		"CountryOfOrigin": {
-			SearchTerms: []string{"country of origin"},
-			CellRanges: []CellRange{
-				{StartCell: "B21", EndCell: "D21"},
-			},
-			Offset: 3,
-		},
-		"CustomsTariffCode": {
-			SearchTerms: []string{"customs tariff code"},
-			CellRanges: []CellRange{
-				{StartCell: "B22", EndCell: "D22"},
-			},
-			Offset: 3,
-		},
-		"ExportControlRegulated": {
-			SearchTerms: []string{"export control regulations"},
-			CellRanges: []CellRange{
-				{StartCell: "B23", EndCell: "D23"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      3,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"No"},
-					Offset:      4,
-				},
-			},
-		},
-		"PartClassification": {
-			SearchTerms: []string{"classification of the part"},
-			CellRanges: []CellRange{
-				{StartCell: "B24", EndCell: "D24"},
-			},
-			TriColumnCheckBoxClf: true,
-			TriColumnClfCriteria: TriClassificationCritera{
-				TYPE_1: ClassificationCriteria{
-					Label:       "DUAL",
-					SearchTerms: []string{"DU", "DUAL"},
-					Offset:      3,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "MILITARY",
-					SearchTerms: []string{"MIL"},
-					Offset:      3,
-				},
-				TYPE_3: ClassificationCriteria{
-					Label:       "CIVIL",
-					SearchTerms: []string{"CIVIL"},
-					Offset:      5,
-				},
-			},
-		},
-		"ControlListClassificationNumber": {
-			SearchTerms: []string{"control list classification number"},
-			CellRanges: []CellRange{
-				{StartCell: "B28", EndCell: "D28"},
-			},
-			Offset: 3,
-		},
-		"ThirdCountryControlledContent": {
-			SearchTerms: []string{"third country controlled content"},
-			CellRanges: []CellRange{
-				{StartCell: "B29", EndCell: "D29"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      3,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"No"},
-					Offset:      4,
-				},
-			},
-		},
-		"EndUserStatementRequired": {
-			SearchTerms: []string{"end user statement will be required"},
-			CellRanges: []CellRange{
-				{StartCell: "B31", EndCell: "E31"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      4,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"No"},
-					Offset:      4,
-				},
-			},
-		},
-		"ExportLicenceShipmentRequired": {
-			SearchTerms: e.ReplaceCompanyNames([]string{"Export Licence for shipment to {companyName}"}),
-			CellRanges: []CellRange{
-				{StartCell: "B32", EndCell: "E32"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      4,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"NO"},
-					Offset:      4,
-				},
-			},
-		},
-		"ExportLicenceEndUserRequired": {
-			SearchTerms: e.ReplaceCompanyNames([]string{"Export Licence for shipment to {companyName} Specified End User"}),
-			CellRanges: []CellRange{
-				{StartCell: "B33", EndCell: "E33"},
-			},
-			TriColumnCheckBoxClf: true,
-			TriColumnClfCriteria: TriClassificationCritera{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      4,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"NO"},
-					Offset:      4,
-				},
-				TYPE_3: ClassificationCriteria{
-					Label:       "END USER NOT ADVISED TO SUPPLIER",
-					SearchTerms: []string{"END USER NOT ADVISED TO SUPPLIER"},
-					Offset:      4,
-				},
-			},
-		},
-		"AdditionalExportDocsRequired": {
-			SearchTerms: []string{"Are other export documents required to be completed by"},
-			CellRanges: []CellRange{
-				{StartCell: "B34", EndCell: "E34"},
-			},
-			DualColumnCheckBoxClf: true,
-			DualColumnClfCriteria: DualClassificationCriteria{
-				TYPE_1: ClassificationCriteria{
-					Label:       "YES",
-					SearchTerms: []string{"YES"},
-					Offset:      4,
-				},
-				TYPE_2: ClassificationCriteria{
-					Label:       "NO",
-					SearchTerms: []string{"No"},
-					Offset:      4,
-				},
-			},
-		},
-		"TransferReexportConditions": {
-			SearchTerms: []string{"additional is required to allow the product to be shipped"},
-			CellRanges: []CellRange{
-				{StartCell: "B35", EndCell: "E35"},
-				{StartCell: "B36", EndCell: "E36"},
-			},
-			Offset: 4,
-		},
-		"RepresentativeName": {
-			SearchTerms: []string{"name"},
-			CellRanges: []CellRange{
-				{StartCell: "B49", EndCell: "D49"},
-				{StartCell: "B50", EndCell: "D50"},
-			},
-			Offset: 3,
-		},
-		"RepresentativePosition": {
-			SearchTerms: []string{"position in the company"},
-			CellRanges: []CellRange{
-				{StartCell: "B50", EndCell: "D50"},
-				{StartCell: "B51", EndCell: "D51"},
-			},
-			Offset: 3,
-		},
-		"RepresentativeSignature": {
-			SearchTerms: []string{"Signature of Supplier"},
-			CellRanges: []CellRange{
-				{StartCell: "B51", EndCell: "D51"},
-				{StartCell: "B52", EndCell: "D52"},
-			},
-			Offset:            3,
-			BoolContainsImage: true,
-			BoolClfContainsImage: BoolClassificationCriteria{
-				Offset:      3,
-				SearchTerms: []string{},
-			},
-		},
-		"SupplierCompanySeal": {
-			SearchTerms: []string{"SUPPLIER COMPANY SEAL", "company name"},
-			CellRanges: []CellRange{
-				{StartCell: "B52", EndCell: "D52"},
-				{StartCell: "B53", EndCell: "D53"},
-			},
-			Offset: 3,
-		},
-		"SignatureDate": {
-			SearchTerms: []string{"DATE", "(day/month/year)"},
-			CellRanges: []CellRange{
-				{StartCell: "B53", EndCell: "D53"},
-				{StartCell: "B54", EndCell: "D54"},
-			},
-			Offset: 3,
-		},
+// checkContext returns a CanceledError once the context of the extraction is
+// done
+func (e *ExcelExtractor) checkContext(section string) error {
+	if err := e.ctx.Err(); err != nil {
+		return CanceledError{Section: section, err: err}
 	}
+	return nil
+}
 
-	if err_product_sheet_search != nil {
-		fmt.Println("%w", err_product_sheet_search)
-	} else {
-		e.Extraction.ProductDetails = &ProductDetails{
-			SheetName: productSheetName,
+// extractSection extracts one section of the template into the extraction,
+// recording a panic as a diagnostic of the section
+func (e *ExcelExtractor) extractSection(section SectionTemplate) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.errorf(DiagnosticExtractorFailed, section.Name, "", "", "", "panic extracting section: %v", r)
 		}
-		e.extractDetails(e.Extraction.ProductDetails, productSheetName, productDetailsCriteria)
-	}
-
-	// Define column mappings with search terms
-	columnMappings := []ColumnMapping{
-		{
-			FieldName:   "ItemNum",
-			SearchTerms: []string{"Item"},
-		},
-		{
-			FieldName:   "PartNumber",
-			SearchTerms: []string{"part number"},
-		},
-		{
-			FieldName:   "ComponentManufacturerPartNumber",
-			SearchTerms: []string{"component manufacturer part number", "component manufacturer part-nr"},
-		},
-		{
-			FieldName:   "PartDescription",
-			SearchTerms: []string{"part description", "component description"},
-		},
-		{
-			FieldName:   "ManufacturerOfComponent",
-			SearchTerms: []string{"manufacturer of the component", "manufacturer of component"},
-		},
-		{
-			FieldName:   "ExportRegulationCountry",
-			SearchTerms: []string{"export regulations country"},
-		},
-		{
-			FieldName:   "DualControlListClfNum",
-			SearchTerms: []string{"Dual Use Item  - Control list classification number"},
-		},
-		{
-			FieldName:   "MilitaryControlListClfNum",
-			SearchTerms: []string{"Military Item - Control list classification number"},
-		},
-		{
-			FieldName:   "IndicateLicenseApplication",
-			SearchTerms: []string{"Indicate License Application Form/Type "},
-		},
-		{
-			FieldName:   "TopLevelDeliverableItem",
-			SearchTerms: []string{"Content of the top level deliverable item"},
-		},
-		{
-			FieldName:   "USML_N",
-			SearchTerms: []string{"usml n°", "usml"},
-		},
-		{
-			FieldName:   "ECCN_N",
-			SearchTerms: []string{"ECCN N°", "ECCN", "EAR 99"},
-		},
-		{
-			FieldName:   "US_EA_CONTENT_RATIO",
-			SearchTerms: []string{"Ratio of US EAR controlled content"},
-		},
-	}
+	}()
 
-	// Add controlled content extraction
-	_, controlledContentSheetName, err := e.searchSheetName("controlled content")
+	_, sheetName, err := e.searchSheetName(section.Sheet)
 	if err != nil {
-		fmt.Println("Error finding controlled content sheet:", err)
-	} else {
-		e.Extraction.ControlledContent = e.extractControlledContent(controlledContentSheetName, columnMappings)
+		e.errorf(DiagnosticSheetNotFound, section.Name, "", "", "", "%v", err)
+		return
 	}
 
-	jsonBytes, err := json.Marshal(e.Extraction)
-	if err != nil {
-		fmt.Println("Error:", err)
-		return *e.Extraction
+	switch section.Name {
+	case SectionBuyerDetails:
+		e.Extraction.BuyerDetails = &BuyerDetails{
+			SheetName: sheetName,
+		}
+		e.extractDetails(e.Extraction.BuyerDetails, section.Name, sheetName, e.expandCriteria(section.Fields))
+	case SectionProductDetails:
+		e.Extraction.ProductDetails = &ProductDetails{
+			SheetName: sheetName,
+		}
+		e.extractDetails(e.Extraction.ProductDetails, section.Name, sheetName, e.expandCriteria(section.Fields))
+	case SectionControlledContent:
+		e.Extraction.ControlledContent, e.Extraction.ControlledContentHeader = e.extractControlledContent(sheetName, e.expandColumns(section.Columns), section.HeaderScanRows)
 	}
-	fmt.Printf("Extraction with: %s \n", string(jsonBytes))
+}
 
-	return *e.Extraction
+// Workbook returns the workbook being extracted
+func (e *ExcelExtractor) Workbook() Workbook {
+	return e.workbook
 }
 
 func (e *ExcelExtractor) Close() error {
-	return e.file.Close()
+	return e.workbook.Close()
 }
 
 ///////////////////////
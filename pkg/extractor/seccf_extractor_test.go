@@ -0,0 +1,457 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestMakeExtractorFromReader(t *testing.T) {
+	path := writeTestWorkbook(t,
+		testSheet{
+			name:     "Buyer Details",
+			values:   map[string]string{"B12": "Part Number", "E12": "PN-1", "B21": "Build To Print"},
+			controls: []FormControl{{Cell: "G21", Type: FormControlCheckBox, Text: "YES", Checked: true}},
+		},
+		testSheet{name: "Product Details", values: map[string]string{"C11": "Supplier part number", "E11": "S-1"}},
+		testSheet{name: "Controlled Content", values: map[string]string{"A3": "Item", "B3": "Part Number", "A4": "1", "B4": "PN-1"}},
+	)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	companyNames := CompanyNameList{"Amazon"}
+
+	extract := func(t *testing.T, open func() (*ExcelExtractor, error)) SECCFExtraction {
+		t.Helper()
+		e, err := open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer e.Close()
+		extraction, err := e.ExtractWithError()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return extraction
+	}
+
+	want := extract(t, func() (*ExcelExtractor, error) { return MakeSECCFExtractor(path, companyNames) })
+	if want.BuyerDetails == nil || want.BuyerDetails.PartNumber != "PN-1" || !want.BuyerDetails.BuildToPrint {
+		t.Fatalf("got buyer details %+v from the file, want the part number and the ticked checkbox", want.BuyerDetails)
+	}
+
+	constructors := map[string]func() (*ExcelExtractor, error){
+		"SECCF from reader": func() (*ExcelExtractor, error) {
+			return MakeSECCFExtractorFromReader(bytes.NewReader(data), companyNames)
+		},
+		"SECCF from bytes": func() (*ExcelExtractor, error) {
+			return MakeSECCFExtractorFromBytes(data, companyNames)
+		},
+		"template from reader": func() (*ExcelExtractor, error) {
+			return MakeTemplateExtractorFromReader(iotest.OneByteReader(bytes.NewReader(data)), companyNames, DefaultSECCFTemplate())
+		},
+	}
+	for name, constructor := range constructors {
+		t.Run(name, func(t *testing.T) {
+			got := extract(t, constructor)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("failing reader", func(t *testing.T) {
+		readErr := errors.New("connection reset")
+		if _, err := MakeSECCFExtractorFromReader(iotest.TimeoutReader(bytes.NewReader(data)), companyNames); err == nil {
+			t.Error("reader failing halfway: got no error")
+		}
+		if _, err := MakeSECCFExtractorFromReader(iotest.ErrReader(readErr), companyNames); !errors.Is(err, readErr) {
+			t.Errorf("got error %v, want it to wrap %v", err, readErr)
+		}
+	})
+}
+
+// cancelingWorkbook cancels an extraction once it reads a sheet, or once it
+// iterates to a row of the sheet
+type cancelingWorkbook struct {
+	Workbook
+	sheetName string
+	cancelRow int // 0 cancels on the first read of the sheet
+	cancel    context.CancelFunc
+}
+
+func (w *cancelingWorkbook) Rows(sheetName string) ([][]string, error) {
+	if sheetName == w.sheetName && w.cancelRow == 0 {
+		w.cancel()
+	}
+	return w.Workbook.Rows(sheetName)
+}
+
+func (w *cancelingWorkbook) IterateRows(sheetName string, fn func(row int, values []string) bool) error {
+	return w.Workbook.IterateRows(sheetName, func(row int, values []string) bool {
+		if sheetName == w.sheetName && (w.cancelRow == 0 || row == w.cancelRow) {
+			w.cancel()
+		}
+		return fn(row, values)
+	})
+}
+
+func TestExtractContext(t *testing.T) {
+	template := &FormTemplate{
+		Name: "cancel",
+		Sections: []SectionTemplate{
+			{
+				Name:  SectionBuyerDetails,
+				Sheet: "buyer details",
+				Fields: map[string]SearchCriteria{
+					"PartNumber": {SearchTerms: []string{"part number"}, CellRanges: []CellRange{{StartCell: "B12", EndCell: "D12"}}, Offset: 3},
+				},
+			},
+			{
+				Name:  SectionControlledContent,
+				Sheet: "controlled content",
+				Columns: []ColumnMapping{
+					{FieldName: "ItemNum", SearchTerms: []string{"Item"}},
+					{FieldName: "PartNumber", SearchTerms: []string{"part number"}},
+				},
+				// the header scan stops before the row canceling the table
+				HeaderScanRows: 3,
+			},
+		},
+	}
+	sheets := []testSheet{
+		{name: "Buyer Details", values: map[string]string{"B12": "Part Number", "E12": "PN-1"}},
+		{
+			name: "Controlled Content",
+			values: map[string]string{
+				"A3": "Item", "B3": "Part Number",
+				"A4": "1", "B4": "P-1",
+				"A5": "2", "B5": "P-2",
+				"A6": "3", "B6": "P-3",
+			},
+		},
+	}
+
+	t.Run("before open", func(t *testing.T) {
+		data, err := os.ReadFile(writeTestWorkbook(t, sheets...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		e, err := MakeTemplateExtractorFromBytesContext(ctx, data, nil, template, nil)
+		var canceled CanceledError
+		if e != nil || !errors.As(err, &canceled) || canceled.Section != "" || !errors.Is(err, context.Canceled) {
+			t.Errorf("got extractor %v and error %v, want a CanceledError while opening", e, err)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		sheetName   string
+		cancelRow   int
+		wantSection string
+		wantRows    []string // part numbers of the controlled content
+	}{
+		{
+			name:        "between sections",
+			sheetName:   "Buyer Details",
+			wantSection: SectionBuyerDetails,
+		},
+		{
+			name:        "mid-table",
+			sheetName:   "Controlled Content",
+			cancelRow:   6,
+			wantSection: SectionControlledContent,
+			wantRows:    []string{"P-1", "P-2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			w := &cancelingWorkbook{Workbook: newTestWorkbook(t, sheets...), sheetName: test.sheetName, cancelRow: test.cancelRow, cancel: cancel}
+			e, err := MakeTemplateExtractorFromWorkbook(w, nil, template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// sections extracted at the same time would all see the cancellation
+			e.Sequential = true
+
+			extraction, err := e.ExtractContext(ctx)
+			var canceled CanceledError
+			if !errors.As(err, &canceled) || canceled.Section != test.wantSection || !errors.Is(err, context.Canceled) {
+				t.Fatalf("got error %v, want a CanceledError in section %s", err, test.wantSection)
+			}
+
+			// what was extracted before the cancellation is kept
+			if extraction.BuyerDetails == nil || extraction.BuyerDetails.PartNumber != "PN-1" {
+				t.Errorf("got buyer details %+v, want part number PN-1", extraction.BuyerDetails)
+			}
+			var rows []string
+			for _, content := range extraction.ControlledContent {
+				rows = append(rows, content.PartNumber)
+			}
+			if !reflect.DeepEqual(rows, test.wantRows) {
+				t.Errorf("got controlled content %q, want %q", rows, test.wantRows)
+			}
+			if n := len(extraction.Diagnostics); n == 0 || extraction.Diagnostics[n-1].Code != DiagnosticCanceled {
+				t.Errorf("got diagnostics %+v, want the last one to be %s", extraction.Diagnostics, DiagnosticCanceled)
+			}
+		})
+	}
+
+	t.Run("rerun", func(t *testing.T) {
+		e := newTestExtractor(t, template, sheets...)
+		e.Sequential = true
+		full, err := e.ExtractContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full.BuyerDetails == nil || len(full.ControlledContent) != 3 {
+			t.Fatalf("got %+v, want the buyer details and three rows", full)
+		}
+
+		// a canceled rerun keeps nothing of the earlier one
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		extraction, err := e.ExtractContext(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want it canceled", err)
+		}
+		want := SECCFExtraction{Diagnostics: extraction.Diagnostics}
+		if !reflect.DeepEqual(extraction, want) || len(extraction.Diagnostics) != 1 {
+			t.Errorf("got %+v, want only the cancellation diagnostic", extraction)
+		}
+
+		again, err := e.ExtractContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(again, full) {
+			t.Errorf("got %+v, want the result of the first run %+v", again, full)
+		}
+	})
+}
+
+func TestNoCompanyNamesDiagnostic(t *testing.T) {
+	sheet := testSheet{name: "Buyer Details", values: map[string]string{"B12": "Part Number", "E12": "PN-1"}}
+	plain := &FormTemplate{
+		Name: "plain",
+		Sections: []SectionTemplate{{
+			Name:  SectionBuyerDetails,
+			Sheet: "buyer details",
+			Fields: map[string]SearchCriteria{
+				"PartNumber": {SearchTerms: []string{"part number"}, CellRanges: []CellRange{{StartCell: "B12", EndCell: "D12"}}, Offset: 3},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		template     *FormTemplate
+		companyNames CompanyNameList
+		want         bool
+	}{
+		{name: "placeholder without company names", template: DefaultSECCFTemplate(), want: true},
+		{name: "placeholder with company names", template: DefaultSECCFTemplate(), companyNames: CompanyNameList{"Amazon"}},
+		{name: "no placeholder", template: plain},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.template.UsesCompanyNames(); got != (test.template != plain) {
+				t.Errorf("UsesCompanyNames() = %v", got)
+			}
+			e, err := MakeTemplateExtractorFromWorkbook(newTestWorkbook(t, sheet), test.companyNames, test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+
+			got := false
+			for _, diagnostic := range e.Extract().Diagnostics {
+				if diagnostic.Code == DiagnosticNoCompanyNames {
+					got = diagnostic.Severity == SeverityWarning
+				}
+			}
+			if got != test.want {
+				t.Errorf("got a %s warning: %v, want %v", DiagnosticNoCompanyNames, got, test.want)
+			}
+		})
+	}
+}
+
+// seccfWorkbook returns an .xlsx workbook laid out as the built-in template
+// expects: the labels of the detail fields at their cell ranges with a value
+// or checkboxes next to them, and a controlled content table of rows rows
+func seccfWorkbook(tb testing.TB, rows int) []byte {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	template := DefaultSECCFTemplate()
+	for i, section := range template.Sections {
+		sheetName := strings.ToUpper(section.Sheet[:1]) + section.Sheet[1:]
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+				tb.Fatal(err)
+			}
+		} else if _, err := f.NewSheet(sheetName); err != nil {
+			tb.Fatal(err)
+		}
+
+		if section.IsTable() {
+			for col, column := range section.Columns {
+				cell, _ := excelize.CoordinatesToCellName(col+1, 3)
+				if err := f.SetCellStr(sheetName, cell, column.SearchTerms[0]); err != nil {
+					tb.Fatal(err)
+				}
+				for row := 1; row <= rows; row++ {
+					cell, _ := excelize.CoordinatesToCellName(col+1, row+3)
+					if err := f.SetCellStr(sheetName, cell, fmt.Sprintf("value %d-%d", row, col)); err != nil {
+						tb.Fatal(err)
+					}
+				}
+			}
+			continue
+		}
+
+		fieldNames := make([]string, 0, len(section.Fields))
+		for fieldName := range section.Fields {
+			fieldNames = append(fieldNames, fieldName)
+		}
+		sort.Strings(fieldNames)
+		for n, fieldName := range fieldNames {
+			addSECCFField(tb, f, sheetName, fieldName, section.Fields[fieldName], n%2 == 0)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// addSECCFField writes the label of a field and its value or checkboxes,
+// ticking the first option, or the checkbox when checked is set
+func addSECCFField(tb testing.TB, f *excelize.File, sheetName string, fieldName string, criteria SearchCriteria, checked bool) {
+	if len(criteria.CellRanges) == 0 {
+		return
+	}
+	cellRange := criteria.CellRanges[0]
+	label := strings.ReplaceAll(criteria.SearchTerms[0], "{companyName}", "Amazon")
+	if err := f.SetCellStr(sheetName, cellRange.StartCell, label); err != nil {
+		tb.Fatal(err)
+	}
+
+	addCheckBox := func(cell string, text string, checked bool) {
+		err := f.AddFormControl(sheetName, excelize.FormControl{Cell: cell, Type: excelize.FormControlCheckBox, Text: text, Checked: checked})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	switch {
+	case len(criteria.Options) > 0:
+		for i, option := range criteria.Options {
+			cell, err := classificationCell(cellRange, option)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			addCheckBox(cell, option.SearchTerms[0], i == 0)
+		}
+	case criteria.BoolCheckBox:
+		adjacentRange, err := getAdjacentRange(cellRange, criteria.BoolClfCriteria.Offset, criteria.BoolClfCriteria.RowOffset)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		addCheckBox(adjacentRange.StartCell, criteria.BoolClfCriteria.SearchTerms[0], checked)
+	case !criteria.BoolContainsImage:
+		adjacentRange, err := getAdjacentRange(cellRange, criteria.Offset, criteria.RowOffset)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := f.SetCellStr(sheetName, adjacentRange.StartCell, "value of "+fieldName); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// extractWorkbook opens data and extracts it, one section after another or all at
+// the same time
+func extractWorkbook(t *testing.T, data []byte, sequential bool) (SECCFExtraction, error) {
+	t.Helper()
+	e, err := MakeTemplateExtractorFromBytes(data, CompanyNameList{"Amazon"}, DefaultSECCFTemplate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.Sequential = sequential
+	return e.ExtractWithError()
+}
+
+// TestExtractParallel checks that extracting the sections at the same time
+// gives the result of extracting them one after another, every time and on
+// every rerun. Run it with -race.
+func TestExtractParallel(t *testing.T) {
+	data := seccfWorkbook(t, 20)
+
+	want, wantErr := extractWorkbook(t, data, true)
+	if want.BuyerDetails == nil || want.ProductDetails == nil || len(want.ControlledContent) != 20 || len(want.OptionResults) == 0 {
+		t.Fatalf("sequential extraction is missing sections: %v", want.Diagnostics)
+	}
+
+	for i := 0; i < 5; i++ {
+		got, err := extractWorkbook(t, data, false)
+		if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+			t.Fatalf("run %d: got error %v, want %v", i, err, wantErr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("run %d: parallel extraction differs from the sequential one\ngot  %+v\nwant %+v", i, got, want)
+		}
+	}
+
+	// one extractor run again, after a canceled run in between, gives the
+	// same results in both modes
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	var canceledRuns []SECCFExtraction
+	for _, sequential := range []bool{true, false} {
+		e, err := MakeTemplateExtractorFromBytes(data, CompanyNameList{"Amazon"}, DefaultSECCFTemplate())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer e.Close()
+		e.Sequential = sequential
+
+		for i, ctx := range []context.Context{context.Background(), canceled, context.Background()} {
+			got, err := e.ExtractContext(ctx)
+			if ctx == canceled {
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("sequential %v, run %d: got error %v, want it canceled", sequential, i, err)
+				}
+				canceledRuns = append(canceledRuns, got)
+				continue
+			}
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("sequential %v, run %d: got error %v, want %v", sequential, i, err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("sequential %v, run %d: differs from the first extraction\ngot  %+v\nwant %+v", sequential, i, got, want)
+			}
+		}
+	}
+	if !reflect.DeepEqual(canceledRuns[0], canceledRuns[1]) {
+		t.Errorf("canceled runs differ\nsequential %+v\nparallel   %+v", canceledRuns[0], canceledRuns[1])
+	}
+}
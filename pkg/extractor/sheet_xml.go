@@ -0,0 +1,174 @@
+package extractor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// streamMergedRanges reads the merged ranges of a sheet straight from the
+// worksheet XML of an OOXML package. The cell data before the mergeCells
+// element is skipped without being decoded.
+func streamMergedRanges(data []byte, sheetName string) ([]MergedRange, error) {
+	pkg, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	sheetPath, err := worksheetPath(pkg, sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := pkg.Open(sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	r, err := seekMergeCells(part)
+	if err != nil || r == nil {
+		return nil, err
+	}
+
+	var mergedRanges []MergedRange
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return mergedRanges, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local != "mergeCell" {
+				continue
+			}
+			ref := xmlAttr(token, "", "ref")
+			startCell, endCell, found := strings.Cut(ref, ":")
+			if !found {
+				endCell = startCell
+			}
+			mergedRanges = append(mergedRanges, MergedRange{StartCell: startCell, EndCell: endCell})
+		case xml.EndElement:
+			if token.Name.Local == "mergeCells" {
+				return mergedRanges, nil
+			}
+		}
+	}
+}
+
+// seekMergeCells reads the worksheet XML up to its mergeCells element and
+// returns a reader starting at it, nil when the sheet has no merged ranges.
+// Cell values cannot hold a literal "<", so the tag is matched as text.
+func seekMergeCells(r io.Reader) (io.Reader, error) {
+	// the tail kept between reads holds a tag split over two of them
+	const tail = 64
+	buf := make([]byte, 0, 64<<10)
+	chunk := make([]byte, 32<<10)
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if start := mergeCellsTag(buf); start >= 0 {
+			return io.MultiReader(bytes.NewReader(buf[start:]), r), nil
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) > tail {
+			buf = buf[:copy(buf, buf[len(buf)-tail:])]
+		}
+	}
+}
+
+// mergeCellsTag returns the offset of the first <mergeCells> start tag in
+// buf, with or without a namespace prefix, or -1
+func mergeCellsTag(buf []byte) int {
+	name := []byte("mergeCells")
+	for i := 0; ; {
+		j := bytes.Index(buf[i:], name)
+		if j < 0 {
+			return -1
+		}
+		j += i
+		end := j + len(name)
+		if end >= len(buf) {
+			return -1
+		}
+
+		start := j
+		if start > 0 && buf[start-1] == ':' {
+			start--
+			for start > 0 && isXMLNameByte(buf[start-1]) {
+				start--
+			}
+		}
+		if start > 0 && buf[start-1] == '<' && strings.IndexByte(" \t\r\n/>", buf[end]) >= 0 {
+			return start - 1
+		}
+		i = j + 1
+	}
+}
+
+func isXMLNameByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// worksheetPath finds the part of a sheet through xl/workbook.xml and its
+// relationships
+func worksheetPath(pkg *zip.Reader, sheetName string) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipEntry(pkg, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+
+	var relationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipEntry(pkg, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return "", err
+	}
+
+	for _, sheet := range workbook.Sheets {
+		if !strings.EqualFold(sheet.Name, sheetName) {
+			continue
+		}
+		for _, relationship := range relationships.Relationships {
+			if relationship.ID != sheet.ID {
+				continue
+			}
+			if strings.HasPrefix(relationship.Target, "/") {
+				return strings.TrimPrefix(relationship.Target, "/"), nil
+			}
+			return path.Join("xl", relationship.Target), nil
+		}
+	}
+	return "", SheetNotExistError{sheetName: sheetName}
+}
+
+func decodeZipEntry(pkg *zip.Reader, name string, v any) error {
+	entry, err := readZipEntry(pkg, name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(entry, v); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestStreamMergedRanges(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	for row := 1; row <= 2000; row++ {
+		// cell text naming the element must not be taken for it
+		if err := f.SetCellStr("Sheet1", fmt.Sprintf("A%d", row), "<mergeCells> mergeCells"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, merge := range []CellRange{{StartCell: "B2", EndCell: "D2"}, {StartCell: "A2001", EndCell: "A2003"}} {
+		if err := f.MergeCell("Sheet1", merge.StartCell, merge.EndCell); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := streamMergedRanges(buf.Bytes(), "Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MergedRange{{StartCell: "B2", EndCell: "D2"}, {StartCell: "A2001", EndCell: "A2003"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSeekMergeCells(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string // start of the reader returned, empty for nil
+	}{
+		{
+			name: "merged ranges",
+			xml:  `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>mergeCells &lt;mergeCells&gt;</t></is></c></row></sheetData><mergeCells count="1"><mergeCell ref="A1:B1"/></mergeCells></worksheet>`,
+			want: `<mergeCells count="1">`,
+		},
+		{
+			name: "namespace prefix",
+			xml:  `<x:worksheet><x:sheetData/><x:mergeCells count="1"><x:mergeCell ref="A1:B1"/></x:mergeCells></x:worksheet>`,
+			want: `<x:mergeCells count="1">`,
+		},
+		{
+			name: "no merged ranges",
+			xml:  `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>mergeCells</t></is></c></row></sheetData></worksheet>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// one byte reads split the tag over many of them
+			r, err := seekMergeCells(iotest.OneByteReader(strings.NewReader(test.xml)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r == nil {
+				if test.want != "" {
+					t.Fatalf("got no mergeCells element, want %q", test.want)
+				}
+				return
+			}
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(rest), test.want) {
+				t.Errorf("got %q, want it to start with %q", rest, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package extractor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sheetSnapshot is everything the extractor reads from one sheet. The sheet
+// is loaded once, on first use, and every lookup is answered from memory.
+type sheetSnapshot struct {
+	rows         [][]string // displayed values, rows[row-1][col-1]
+	merges       *mergeIndex
+	formControls []FormControl
+	pictureCells map[string]bool
+}
+
+// sheetCache holds the snapshots of the sheets read so far. It is shared by
+// the sections extracted in parallel: every sheet is loaded once, different
+// sheets at the same time. A sheet that failed, e.g. over the rows limit, is
+// not read again.
+type sheetCache struct {
+	mu     sync.Mutex
+	sheets map[string]*cachedSheet
+}
+
+type cachedSheet struct {
+	once     sync.Once
+	snapshot *sheetSnapshot
+	err      error
+}
+
+func newSheetCache() *sheetCache {
+	return &sheetCache{sheets: map[string]*cachedSheet{}}
+}
+
+// get returns the snapshot of a sheet, loading it on first use. Callers
+// asking for a sheet being loaded wait for it.
+func (c *sheetCache) get(sheetName string, load func() (*sheetSnapshot, error)) (*sheetSnapshot, error) {
+	c.mu.Lock()
+	sheet, ok := c.sheets[sheetName]
+	if !ok {
+		sheet = &cachedSheet{}
+		c.sheets[sheetName] = sheet
+	}
+	c.mu.Unlock()
+
+	sheet.once.Do(func() {
+		sheet.snapshot, sheet.err = load()
+	})
+	return sheet.snapshot, sheet.err
+}
+
+// loaded tells whether a sheet was asked for already
+func (c *sheetCache) loaded(sheetName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.sheets[sheetName]
+	return ok
+}
+
+// getSnapshot returns the snapshot of a sheet, loading it on first use
+func (e *ExcelExtractor) getSnapshot(sheetName string) (*sheetSnapshot, error) {
+	snapshot, err := e.sheets.get(sheetName, func() (*sheetSnapshot, error) {
+		return loadSnapshot(e.workbook, sheetName)
+	})
+	if err != nil {
+		e.recordLimit(err)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func loadSnapshot(workbook Workbook, sheetName string) (*sheetSnapshot, error) {
+	rows, err := workbook.Rows(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows: %w", err)
+	}
+
+	mergedRanges, err := workbook.MergedRanges(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged cells: %w", err)
+	}
+	merges, err := newMergeIndex(mergedRanges)
+	if err != nil {
+		return nil, err
+	}
+	for row := range merges.byStartRow {
+		if row <= len(rows) {
+			merges.setRowValues(row, rows[row-1])
+		}
+	}
+
+	formControls, err := workbook.FormControls(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get form controls: %w", err)
+	}
+
+	cells, err := workbook.PictureCells(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pictures: %w", err)
+	}
+	pictureCells := make(map[string]bool, len(cells))
+	for _, cell := range cells {
+		pictureCells[cell] = true
+	}
+
+	return &sheetSnapshot{
+		rows:         rows,
+		merges:       merges,
+		formControls: formControls,
+		pictureCells: pictureCells,
+	}, nil
+}
+
+// value returns the value at a 1-based column and row, empty outside the
+// used range
+func (s *sheetSnapshot) value(col int, row int) string {
+	if row < 1 || row > len(s.rows) || col < 1 || col > len(s.rows[row-1]) {
+		return ""
+	}
+	return s.rows[row-1][col-1]
+}
+
+// cellValue returns the value of a cell
+func (s *sheetSnapshot) cellValue(cell string) (string, error) {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return "", err
+	}
+	return s.value(col, row), nil
+}
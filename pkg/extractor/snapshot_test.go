@@ -0,0 +1,233 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// benchmarkFields is the number of fields of the details sheet of the
+// benchmark, each a label, a value and a YES and a NO checkbox
+const benchmarkFields = 100
+
+// detailsWorkbook returns an .xlsx workbook whose "Details" sheet holds the
+// benchmark fields, one per row
+func detailsWorkbook(tb testing.TB) []byte {
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", "Details"); err != nil {
+		tb.Fatal(err)
+	}
+	for row := 1; row <= benchmarkFields; row++ {
+		err := f.SetSheetRow("Details", fmt.Sprintf("B%d", row), &[]interface{}{fmt.Sprintf("Label %d", row), nil, nil, fmt.Sprintf("value %d", row)})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for i, text := range []string{"YES", "NO"} {
+			cell, _ := excelize.CoordinatesToCellName(7+i, row)
+			err := f.AddFormControl("Details", excelize.FormControl{Cell: cell, Type: excelize.FormControlCheckBox, Text: text, Checked: i == row%2})
+			if err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkDetailLookups compares the lookups of a details section read
+// straight from the workbook with the same lookups answered by the sheet
+// snapshot. Every field searches its label, reads its value and looks at
+// the checkboxes; both open the workbook on every iteration.
+func BenchmarkDetailLookups(b *testing.B) {
+	data := detailsWorkbook(b)
+
+	b.Run("workbook", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e, err := MakeTemplateExtractorFromBytes(data, nil, DefaultSECCFTemplate())
+			if err != nil {
+				b.Fatal(err)
+			}
+			for row := 1; row <= benchmarkFields; row++ {
+				if _, err := e.workbook.Rows("Details"); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := e.workbook.CellValue("Details", fmt.Sprintf("E%d", row)); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := e.workbook.FormControls("Details"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			e.Close()
+		}
+	})
+
+	b.Run("snapshot", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e, err := MakeTemplateExtractorFromBytes(data, nil, DefaultSECCFTemplate())
+			if err != nil {
+				b.Fatal(err)
+			}
+			for row := 1; row <= benchmarkFields; row++ {
+				if _, err := e.getSheetRows("Details"); err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := e.readCell("Details", fmt.Sprintf("E%d", row)); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := e.getFormControls("Details"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			e.Close()
+		}
+	})
+}
+
+// benchmarkRows is the size of the controlled content table of the benchmark
+const benchmarkRows = 10000
+
+// controlledContentSection returns the controlled content section of the
+// built-in template
+func controlledContentSection(tb testing.TB) SectionTemplate {
+	for _, section := range DefaultSECCFTemplate().Sections {
+		if section.Name == SectionControlledContent {
+			return section
+		}
+	}
+	tb.Fatal("built-in template has no controlled content section")
+	return SectionTemplate{}
+}
+
+// controlledContentWorkbook returns an .xlsx workbook whose controlled
+// content sheet has the header of the built-in template in row 3 and rows
+// of data below it
+func controlledContentWorkbook(tb testing.TB, section SectionTemplate, rows int) []byte {
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", "Controlled Content"); err != nil {
+		tb.Fatal(err)
+	}
+
+	header := make([]interface{}, len(section.Columns))
+	for i, column := range section.Columns {
+		header[i] = column.SearchTerms[0]
+	}
+	writer, err := f.NewStreamWriter("Controlled Content")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := writer.SetRow("A1", []interface{}{"Controlled content"}); err != nil {
+		tb.Fatal(err)
+	}
+	if err := writer.SetRow("A3", header); err != nil {
+		tb.Fatal(err)
+	}
+	for row := 1; row <= rows; row++ {
+		values := make([]interface{}, len(section.Columns))
+		values[0] = row
+		for i := 1; i < len(values); i++ {
+			values[i] = fmt.Sprintf("value %d-%d", row, i)
+		}
+		if err := writer.SetRow(fmt.Sprintf("A%d", row+3), values); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extractCellByCell reads the table the way it was read before snapshots,
+// one workbook lookup per cell
+func extractCellByCell(e *ExcelExtractor, sheetName string, columnMappings []ColumnMapping, header *HeaderMatch) ([]ControlCotent, error) {
+	var contents []ControlCotent
+	for row := header.DataRow(); ; row++ {
+		firstCellValue, err := e.workbook.CellValue(sheetName, fmt.Sprintf("%s%d", columnMappings[0].FoundColumn, row))
+		if err != nil {
+			return nil, err
+		}
+		if firstCellValue == "" {
+			return contents, nil
+		}
+
+		content := ControlCotent{SheetName: sheetName}
+		contentValue := reflect.ValueOf(&content).Elem()
+		for _, mapping := range columnMappings {
+			if mapping.FoundColumn == "" {
+				continue
+			}
+			cellValue, err := e.workbook.CellValue(sheetName, fmt.Sprintf("%s%d", mapping.FoundColumn, row))
+			if err != nil {
+				return nil, err
+			}
+			if field := contentValue.FieldByName(mapping.FieldName); field.IsValid() && field.CanSet() {
+				field.SetString(strings.TrimSpace(cellValue))
+			}
+		}
+		contents = append(contents, content)
+	}
+}
+
+// BenchmarkControlledContent compares reading a large controlled content
+// table cell by cell with streaming it through the row iterator. Both open the
+// workbook and find the header on every iteration.
+func BenchmarkControlledContent(b *testing.B) {
+	section := controlledContentSection(b)
+	data := controlledContentWorkbook(b, section, benchmarkRows)
+
+	open := func(b *testing.B) (*ExcelExtractor, []ColumnMapping) {
+		e, err := MakeTemplateExtractorFromBytes(data, nil, DefaultSECCFTemplate())
+		if err != nil {
+			b.Fatal(err)
+		}
+		return e, e.expandColumns(section.Columns)
+	}
+
+	b.Run("cell_by_cell", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e, columnMappings := open(b)
+			header, err := e.findHeaderRow("Controlled Content", columnMappings, section.HeaderScanRows)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i := range columnMappings {
+				columnMappings[i].FoundColumn, _ = findColumnByHeader(header.texts, columnMappings[i].SearchTerms)
+			}
+			contents, err := extractCellByCell(e, "Controlled Content", columnMappings, header)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(contents) != benchmarkRows {
+				b.Fatalf("got %d rows, want %d", len(contents), benchmarkRows)
+			}
+			e.Close()
+		}
+	})
+
+	b.Run("rows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e, columnMappings := open(b)
+			contents, header := e.extractControlledContent("Controlled Content", columnMappings, section.HeaderScanRows)
+			if header == nil || len(contents) != benchmarkRows {
+				b.Fatalf("got %d rows, want %d: %v", len(contents), benchmarkRows, e.Extraction.Diagnostics)
+			}
+			e.Close()
+		}
+	})
+}
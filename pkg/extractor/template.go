@@ -0,0 +1,244 @@
+package extractor
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section names understood by the extractor. Each one maps to a field of
+// SECCFExtraction.
+const (
+	SectionBuyerDetails      = "buyer_details"
+	SectionProductDetails    = "product_details"
+	SectionControlledContent = "controlled_content"
+)
+
+// companyNamePlaceholder is replaced by every configured company name in
+// template search terms.
+const companyNamePlaceholder = "{companyName}"
+
+//go:embed templates/seccf.yaml
+var seccfTemplateSource []byte
+
+// FormTemplate describes where every field of a form lives in a workbook.
+type FormTemplate struct {
+	Name     string            `json:"name" yaml:"name"`
+	Sections []SectionTemplate `json:"sections" yaml:"sections"`
+	// CheckBoxTolerance is the default distance in pixels a checkbox may sit
+	// outside its target cell, DefaultCheckBoxTolerance when 0
+	CheckBoxTolerance float64 `json:"checkbox_tolerance,omitempty" yaml:"checkbox_tolerance,omitempty"`
+	// CheckMarks and UncheckedMarks are the typed marks read in option cells
+	// of forms without checkbox controls, DefaultCheckMarks and
+	// DefaultUncheckedMarks when empty
+	CheckMarks     []string `json:"check_marks,omitempty" yaml:"check_marks,omitempty"`
+	UncheckedMarks []string `json:"unchecked_marks,omitempty" yaml:"unchecked_marks,omitempty"`
+}
+
+// SectionTemplate describes one sheet of the form. A section either holds
+// labelled fields (Fields) or a table of rows (Columns), never both.
+type SectionTemplate struct {
+	Name    string                    `json:"name" yaml:"name"`   // one of the Section* constants
+	Sheet   string                    `json:"sheet" yaml:"sheet"` // word searched for in the sheet names
+	Fields  map[string]SearchCriteria `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Columns []ColumnMapping           `json:"columns,omitempty" yaml:"columns,omitempty"`
+	// HeaderScanRows limits the header search of a table to the first rows of
+	// the sheet, 0 scans the whole sheet
+	HeaderScanRows int `json:"header_scan_rows,omitempty" yaml:"header_scan_rows,omitempty"`
+}
+
+// IsTable reports whether the section is extracted as a table of rows
+func (s *SectionTemplate) IsTable() bool {
+	return len(s.Columns) > 0
+}
+
+// sectionTargets holds the struct type every section is extracted into
+var sectionTargets = map[string]reflect.Type{
+	SectionBuyerDetails:      reflect.TypeOf(BuyerDetails{}),
+	SectionProductDetails:    reflect.TypeOf(ProductDetails{}),
+	SectionControlledContent: reflect.TypeOf(ControlCotent{}),
+}
+
+// DefaultSECCFTemplate returns the built-in SECCF template. Every call
+// returns a fresh copy, so callers may modify it freely.
+func DefaultSECCFTemplate() *FormTemplate {
+	template, err := ParseTemplate(seccfTemplateSource, "yaml")
+	if err != nil {
+		// the embedded template is part of the source tree
+		panic(fmt.Sprintf("invalid built-in SECCF template: %v", err))
+	}
+	return template
+}
+
+// LoadTemplate reads a template file. Files ending in ".json" are parsed as
+// JSON, everything else as YAML.
+func LoadTemplate(path string) (*FormTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	return ParseTemplate(data, format)
+}
+
+// ParseTemplate parses and validates a template given in "json" or "yaml"
+func ParseTemplate(data []byte, format string) (*FormTemplate, error) {
+	var template FormTemplate
+
+	switch strings.ToLower(format) {
+	case "json":
+		if err := json.Unmarshal(data, &template); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON template: %w", err)
+		}
+	case "yaml", "yml":
+		if err := yaml.Unmarshal(data, &template); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML template: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported template format: %s", format)
+	}
+
+	if err := template.Validate(); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// Validate checks that every section and field of the template can be
+// extracted into SECCFExtraction.
+func (t *FormTemplate) Validate() error {
+	if len(t.Sections) == 0 {
+		return fmt.Errorf("template %q has no sections", t.Name)
+	}
+
+	seen := map[string]bool{}
+	for _, section := range t.Sections {
+		target, ok := sectionTargets[section.Name]
+		if !ok {
+			return fmt.Errorf("template %q: unknown section %q", t.Name, section.Name)
+		}
+		if seen[section.Name] {
+			return fmt.Errorf("template %q: section %q defined twice", t.Name, section.Name)
+		}
+		seen[section.Name] = true
+
+		if section.Sheet == "" {
+			return fmt.Errorf("template %q: section %q has no sheet", t.Name, section.Name)
+		}
+
+		isTableTarget := section.Name == SectionControlledContent
+		if isTableTarget != section.IsTable() || (section.IsTable() && len(section.Fields) > 0) {
+			return fmt.Errorf("template %q: section %q must define either fields or columns", t.Name, section.Name)
+		}
+
+		for fieldName, criteria := range section.Fields {
+			if err := validateTargetField(target, fieldName); err != nil {
+				return fmt.Errorf("template %q: section %q: %w", t.Name, section.Name, err)
+			}
+			if len(criteria.SearchTerms) == 0 || (len(criteria.CellRanges) == 0 && !criteria.LabelSearch) {
+				return fmt.Errorf("template %q: section %q: field %s needs search_terms and either cell_ranges or label_search", t.Name, section.Name, fieldName)
+			}
+			for _, option := range criteria.Options {
+				if option.Label == "" || len(option.SearchTerms) == 0 {
+					return fmt.Errorf("template %q: section %q: field %s: every option needs a label and search_terms", t.Name, section.Name, fieldName)
+				}
+			}
+			if criteria.SearchRegion != nil {
+				if _, err := parseRegion(*criteria.SearchRegion); err != nil {
+					return fmt.Errorf("template %q: section %q: field %s: %w", t.Name, section.Name, fieldName, err)
+				}
+			}
+		}
+
+		for _, column := range section.Columns {
+			if err := validateTargetField(target, column.FieldName); err != nil {
+				return fmt.Errorf("template %q: section %q: %w", t.Name, section.Name, err)
+			}
+			if len(column.SearchTerms) == 0 {
+				return fmt.Errorf("template %q: section %q: column %s needs search_terms", t.Name, section.Name, column.FieldName)
+			}
+		}
+	}
+	return nil
+}
+
+func validateTargetField(target reflect.Type, fieldName string) error {
+	field, ok := target.FieldByName(fieldName)
+	if !ok || !field.IsExported() || fieldName == "SheetName" {
+		return fmt.Errorf("unknown field %s for %s", fieldName, target.Name())
+	}
+	return nil
+}
+
+// UsesCompanyNames tells whether a search term of the template holds the
+// {companyName} placeholder, which matches nothing without company names.
+func (t *FormTemplate) UsesCompanyNames() bool {
+	hasPlaceholder := func(terms []string) bool {
+		for _, term := range terms {
+			if strings.Contains(term, companyNamePlaceholder) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, section := range t.Sections {
+		for _, criteria := range section.Fields {
+			if hasPlaceholder(criteria.SearchTerms) {
+				return true
+			}
+		}
+		for _, column := range section.Columns {
+			if hasPlaceholder(column.SearchTerms) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandSearchTerms replaces the company name placeholder in search terms.
+// Terms without the placeholder are kept as they are.
+func (e *ExcelExtractor) expandSearchTerms(terms []string) []string {
+	var results []string
+	for _, term := range terms {
+		if strings.Contains(term, companyNamePlaceholder) {
+			results = append(results, e.ReplaceCompanyNames([]string{term})...)
+		} else {
+			results = append(results, term)
+		}
+	}
+	return results
+}
+
+// expandCriteria returns a copy of the section criteria with company names
+// filled in
+func (e *ExcelExtractor) expandCriteria(fields map[string]SearchCriteria) map[string]SearchCriteria {
+	criteria := make(map[string]SearchCriteria, len(fields))
+	for fieldName, searchCriteria := range fields {
+		searchCriteria.SearchTerms = e.expandSearchTerms(searchCriteria.SearchTerms)
+		criteria[fieldName] = searchCriteria
+	}
+	return criteria
+}
+
+// expandColumns returns a copy of the column mappings with company names
+// filled in
+func (e *ExcelExtractor) expandColumns(columns []ColumnMapping) []ColumnMapping {
+	mappings := make([]ColumnMapping, len(columns))
+	for i, column := range columns {
+		column.SearchTerms = e.expandSearchTerms(column.SearchTerms)
+		column.FoundColumn = ""
+		mappings[i] = column
+	}
+	return mappings
+}
@@ -0,0 +1,236 @@
+package extractor
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Workbook is the read access the extractor needs from a workbook. Sheets
+// and cells are addressed by name, e.g. "Buyer Details" and "B12".
+type Workbook interface {
+	// SheetNames returns the sheet names in workbook order
+	SheetNames() []string
+	// CellValue returns the displayed value of a cell, empty for the cells
+	// of a merged range other than its top-left one
+	CellValue(sheetName string, cell string) (string, error)
+	// Rows returns the displayed values of all rows, trailing empty cells
+	// and rows left out
+	Rows(sheetName string) ([][]string, error)
+	// IterateRows calls fn with the displayed values of every row, from the
+	// first one, without holding the sheet in memory. It stops when fn
+	// returns false.
+	IterateRows(sheetName string, fn func(row int, values []string) bool) error
+	// MergedRanges returns the merged blocks of a sheet. Their Value is left
+	// empty, the extractor reads it from the rows.
+	MergedRanges(sheetName string) ([]MergedRange, error)
+	// ColumnWidth returns the width of a 1-based column in characters
+	ColumnWidth(sheetName string, col int) (float64, error)
+	// RowHeight returns the height of a 1-based row in points
+	RowHeight(sheetName string, row int) (float64, error)
+	// FormControls returns the form controls of a sheet
+	FormControls(sheetName string) ([]FormControl, error)
+	// PictureCells returns the cells pictures are anchored at
+	PictureCells(sheetName string) ([]string, error)
+	Close() error
+}
+
+// Form control types
+const (
+	FormControlButton       = "button"
+	FormControlCheckBox     = "checkbox"
+	FormControlGroupBox     = "group_box"
+	FormControlLabel        = "label"
+	FormControlOptionButton = "option_button"
+	FormControlScrollBar    = "scroll_bar"
+	FormControlSpinButton   = "spin_button"
+)
+
+// FormControl is a form control anchored at a cell
+type FormControl struct {
+	Cell string // anchor cell
+	Type string // one of the FormControl* types
+	Text string
+	// Paragraph holds the text runs of a control with formatted text
+	Paragraph []string
+	Checked   bool
+	// CellLink is the cell bound to the control, e.g. "B4" or "Sheet1!$B$4"
+	CellLink string
+	// offsets from the anchor cell and size, in pixels, 0 when unknown
+	OffsetX, OffsetY int
+	Width, Height    int
+}
+
+// excelizeWorkbook reads a workbook opened with excelize. Sections are
+// extracted at the same time, so it is used from several goroutines.
+type excelizeWorkbook struct {
+	file *excelize.File
+	// data is the package the file was opened from, nil when it was
+	// decrypted or converted
+	data []byte
+	// mu serializes the calls to excelize, which loads worksheets, styles and
+	// VML drawings without locking. Rows are decoded outside of it, so sheets
+	// are still read in parallel.
+	mu sync.Mutex
+}
+
+var excelizeFormControlTypes = map[excelize.FormControlType]string{
+	excelize.FormControlButton:       FormControlButton,
+	excelize.FormControlCheckBox:     FormControlCheckBox,
+	excelize.FormControlGroupBox:     FormControlGroupBox,
+	excelize.FormControlLabel:        FormControlLabel,
+	excelize.FormControlOptionButton: FormControlOptionButton,
+	excelize.FormControlScrollBar:    FormControlScrollBar,
+	excelize.FormControlSpinButton:   FormControlSpinButton,
+}
+
+func (w *excelizeWorkbook) SheetNames() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.GetSheetList()
+}
+
+func (w *excelizeWorkbook) CellValue(sheetName string, cell string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.GetCellValue(sheetName, cell)
+}
+
+// Rows is read row by row as GetRows does, without holding mu for the sheet
+func (w *excelizeWorkbook) Rows(sheetName string) ([][]string, error) {
+	return collectRows(w, sheetName)
+}
+
+func (w *excelizeWorkbook) IterateRows(sheetName string, fn func(row int, values []string) bool) error {
+	w.mu.Lock()
+	rows, err := w.file.Rows(sheetName)
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for row := 1; rows.Next(); row++ {
+		// formatting the values reads the shared strings and styles
+		w.mu.Lock()
+		values, err := rows.Columns()
+		w.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if !fn(row, values) {
+			return nil
+		}
+	}
+	return rows.Error()
+}
+
+// MergedRanges reads the merged ranges from the worksheet XML of the package
+// when it is at hand, as excelize would load and keep the whole worksheet
+func (w *excelizeWorkbook) MergedRanges(sheetName string) ([]MergedRange, error) {
+	if w.data != nil {
+		if mergedRanges, err := streamMergedRanges(w.data, sheetName); err == nil {
+			return mergedRanges, nil
+		}
+	}
+
+	w.mu.Lock()
+	mergedCells, err := w.file.GetMergeCells(sheetName)
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	mergedRanges := make([]MergedRange, 0, len(mergedCells))
+	for _, mergedCell := range mergedCells {
+		mergedRanges = append(mergedRanges, MergedRange{
+			StartCell: mergedCell.GetStartAxis(),
+			EndCell:   mergedCell.GetEndAxis(),
+		})
+	}
+	return mergedRanges, nil
+}
+
+func (w *excelizeWorkbook) ColumnWidth(sheetName string, col int) (float64, error) {
+	colName, err := excelize.ColumnNumberToName(col)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.GetColWidth(sheetName, colName)
+}
+
+func (w *excelizeWorkbook) RowHeight(sheetName string, row int) (float64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.GetRowHeight(sheetName, row)
+}
+
+func (w *excelizeWorkbook) FormControls(sheetName string) ([]FormControl, error) {
+	w.mu.Lock()
+	controls, err := w.file.GetFormControls(sheetName)
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	formControls := make([]FormControl, 0, len(controls))
+	for _, control := range controls {
+		formControl := FormControl{
+			Cell:     control.Cell,
+			Type:     excelizeFormControlTypes[control.Type],
+			Text:     control.Text,
+			Checked:  control.Checked,
+			CellLink: control.CellLink,
+			OffsetX:  control.Format.OffsetX,
+			OffsetY:  control.Format.OffsetY,
+			Width:    int(control.Width),
+			Height:   int(control.Height),
+		}
+		for _, run := range control.Paragraph {
+			formControl.Paragraph = append(formControl.Paragraph, run.Text)
+		}
+		formControls = append(formControls, formControl)
+	}
+	return formControls, nil
+}
+
+func (w *excelizeWorkbook) PictureCells(sheetName string) ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.GetPictureCells(sheetName)
+}
+
+func (w *excelizeWorkbook) Close() error {
+	return w.file.Close()
+}
+
+// findSheet returns the index of a sheet, compared ignoring case as Excel does
+func findSheet(sheetNames []string, sheetName string) int {
+	for i, name := range sheetNames {
+		if strings.EqualFold(name, sheetName) {
+			return i
+		}
+	}
+	return -1
+}
+
+// collectRows reads all rows of a sheet through IterateRows, trailing empty
+// rows left out
+func collectRows(workbook Workbook, sheetName string) ([][]string, error) {
+	var rows [][]string
+	lastRow := 0
+	err := workbook.IterateRows(sheetName, func(row int, values []string) bool {
+		rows = append(rows, values)
+		if len(values) > 0 {
+			lastRow = row
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows[:lastRow], nil
+}
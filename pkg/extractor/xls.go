@@ -0,0 +1,616 @@
+package extractor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Legacy .xls workbooks (BIFF8, Excel 97-2003) are parsed from the Workbook
+// stream of their OLE compound file and imported with their cell values,
+// number formats, merged ranges, sheet names and checkbox states with their
+// labels.
+
+// BIFF8 record types
+const (
+	xlsRecordFormula    = 0x0006
+	xlsRecordEOF        = 0x000A
+	xlsRecordDateMode   = 0x0022
+	xlsRecordFilePass   = 0x002F
+	xlsRecordContinue   = 0x003C
+	xlsRecordObj        = 0x005D
+	xlsRecordBoundSheet = 0x0085
+	xlsRecordMulRK      = 0x00BD
+	xlsRecordXF         = 0x00E0
+	xlsRecordMergeCells = 0x00E5
+	xlsRecordMsoDrawing = 0x00EC
+	xlsRecordSST        = 0x00FC
+	xlsRecordLabelSST   = 0x00FD
+	xlsRecordTxo        = 0x01B6
+	xlsRecordNumber     = 0x0203
+	xlsRecordLabel      = 0x0204
+	xlsRecordBoolErr    = 0x0205
+	xlsRecordString     = 0x0207
+	xlsRecordRK         = 0x027E
+	xlsRecordFormat     = 0x041E
+	xlsRecordBOF        = 0x0809
+)
+
+const (
+	xlsVersionBIFF8      = 0x0600
+	xlsObjectCheckBox    = 0x000B // FtCmo object type of a checkbox
+	xlsClientAnchorShape = 0xF010 // OfficeArtClientAnchorSheet record
+)
+
+type xlsCell struct {
+	row, col int // 0-based
+	text     string
+	number   float64
+	kind     byte // 's' string, 'n' number, 'b' boolean
+	xf       uint16
+}
+
+type xlsSheet struct {
+	name       string
+	offset     uint32
+	cells      []xlsCell
+	merges     []importedArea
+	checkBoxes []importedCheckBox
+}
+
+type xlsWorkbook struct {
+	sheets    []*xlsSheet
+	sst       []string
+	formats   map[uint16]string // custom number formats by index
+	xfFormats []uint16          // number format index of every XF record
+	date1904  bool
+	limits    Limits
+	cellCount int   // cells read so far
+	limitErr  error // first limit a cell ran into
+}
+
+// xlsRecordAt returns the record starting at pos and the position of the next
+func xlsRecordAt(stream []byte, pos int) (uint16, []byte, int, bool) {
+	if pos+4 > len(stream) {
+		return 0, nil, pos, false
+	}
+	id := binary.LittleEndian.Uint16(stream[pos:])
+	size := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+	if pos+4+size > len(stream) {
+		return 0, nil, pos, false
+	}
+	return id, stream[pos+4 : pos+4+size], pos + 4 + size, true
+}
+
+// openXLS converts the BIFF8 Workbook stream into an excelize workbook
+func openXLS(stream []byte, limits Limits) (*excelize.File, error) {
+	workbook, err := parseXLSGlobals(stream)
+	if err != nil {
+		return nil, err
+	}
+	// the limits are checked before anything is imported
+	if err := checkLimit(LimitSheets, int64(len(workbook.sheets)), int64(limits.MaxSheets)); err != nil {
+		return nil, err
+	}
+	workbook.limits = limits
+	for _, sheet := range workbook.sheets {
+		if err := workbook.parseSheet(stream, sheet); err != nil {
+			if _, ok := err.(LimitExceededError); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("sheet %s: %w", sheet.name, err)
+		}
+	}
+
+	f, err := workbook.toExcelize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert .xls workbook: %w", err)
+	}
+	return f, nil
+}
+
+// parseXLSGlobals reads the workbook globals substream: sheet names, shared
+// strings and number formats
+func parseXLSGlobals(stream []byte) (*xlsWorkbook, error) {
+	id, data, pos, ok := xlsRecordAt(stream, 0)
+	if !ok || id != xlsRecordBOF || len(data) < 2 || binary.LittleEndian.Uint16(data) != xlsVersionBIFF8 {
+		return nil, fmt.Errorf("only BIFF8 (Excel 97-2003) .xls workbooks are supported")
+	}
+
+	workbook := &xlsWorkbook{formats: map[uint16]string{}}
+	for {
+		id, data, next, ok := xlsRecordAt(stream, pos)
+		if !ok {
+			return nil, fmt.Errorf("truncated .xls workbook globals")
+		}
+		pos = next
+
+		switch id {
+		case xlsRecordEOF:
+			return workbook, nil
+		case xlsRecordFilePass:
+			return nil, fmt.Errorf("encrypted .xls workbooks are not supported")
+		case xlsRecordDateMode:
+			workbook.date1904 = len(data) >= 2 && binary.LittleEndian.Uint16(data) == 1
+		case xlsRecordBoundSheet:
+			// only worksheets hold form fields, charts and macro sheets are skipped
+			if len(data) < 8 || data[5] != 0 {
+				continue
+			}
+			name, _ := decodeXLSString(data, 7, int(data[6]))
+			workbook.sheets = append(workbook.sheets, &xlsSheet{name: name, offset: binary.LittleEndian.Uint32(data)})
+		case xlsRecordSST:
+			segments := [][]byte{data}
+			for {
+				id, data, next, ok := xlsRecordAt(stream, pos)
+				if !ok || id != xlsRecordContinue {
+					break
+				}
+				segments = append(segments, data)
+				pos = next
+			}
+			workbook.sst = parseXLSSST(segments)
+		case xlsRecordFormat:
+			if len(data) >= 5 {
+				format, _ := decodeXLSString(data, 4, int(binary.LittleEndian.Uint16(data[2:])))
+				workbook.formats[binary.LittleEndian.Uint16(data)] = format
+			}
+		case xlsRecordXF:
+			if len(data) >= 4 {
+				workbook.xfFormats = append(workbook.xfFormats, binary.LittleEndian.Uint16(data[2:]))
+			}
+		}
+	}
+}
+
+// parseSheet reads the cells, merged ranges and checkboxes of a worksheet
+// substream. Embedded chart substreams are skipped.
+func (w *xlsWorkbook) parseSheet(stream []byte, sheet *xlsSheet) error {
+	pos := int(sheet.offset)
+	depth := 0
+	var anchor *importedArea
+	var checkBox *importedCheckBox
+	formulaString := -1 // index of the formula cell waiting for its STRING record
+
+	for {
+		if w.limitErr != nil {
+			return w.limitErr
+		}
+		id, data, next, ok := xlsRecordAt(stream, pos)
+		if !ok {
+			return fmt.Errorf("truncated worksheet")
+		}
+		pos = next
+
+		switch id {
+		case xlsRecordBOF:
+			depth++
+			continue
+		case xlsRecordEOF:
+			depth--
+			if depth == 0 {
+				return w.limitErr
+			}
+			continue
+		}
+		if depth != 1 {
+			continue
+		}
+
+		switch id {
+		case xlsRecordLabelSST:
+			if len(data) >= 10 {
+				index := int(binary.LittleEndian.Uint32(data[6:]))
+				if index < len(w.sst) {
+					w.addCell(sheet, data, xlsCell{text: w.sst[index], kind: 's'})
+				}
+			}
+		case xlsRecordLabel:
+			if len(data) >= 9 {
+				text, _ := decodeXLSString(data, 8, int(binary.LittleEndian.Uint16(data[6:])))
+				w.addCell(sheet, data, xlsCell{text: text, kind: 's'})
+			}
+		case xlsRecordNumber:
+			if len(data) >= 14 {
+				w.addCell(sheet, data, xlsCell{number: math.Float64frombits(binary.LittleEndian.Uint64(data[6:])), kind: 'n'})
+			}
+		case xlsRecordRK:
+			if len(data) >= 10 {
+				w.addCell(sheet, data, xlsCell{number: decodeRK(binary.LittleEndian.Uint32(data[6:])), kind: 'n'})
+			}
+		case xlsRecordMulRK:
+			if len(data) < 6 {
+				continue
+			}
+			row := int(binary.LittleEndian.Uint16(data))
+			col := int(binary.LittleEndian.Uint16(data[2:]))
+			for i := 4; i+6 <= len(data)-2; i += 6 {
+				w.appendCell(sheet, xlsCell{
+					row:    row,
+					col:    col,
+					number: decodeRK(binary.LittleEndian.Uint32(data[i+2:])),
+					kind:   'n',
+					xf:     binary.LittleEndian.Uint16(data[i:]),
+				})
+				col++
+			}
+		case xlsRecordBoolErr:
+			if len(data) >= 8 && data[7] == 0 {
+				w.addCell(sheet, data, xlsCell{number: float64(data[6]), kind: 'b'})
+			}
+		case xlsRecordFormula:
+			if len(data) < 14 {
+				continue
+			}
+			// the cached result is a number unless its last two bytes are 0xFFFF
+			if binary.LittleEndian.Uint16(data[12:]) != 0xFFFF {
+				w.addCell(sheet, data, xlsCell{number: math.Float64frombits(binary.LittleEndian.Uint64(data[6:])), kind: 'n'})
+				continue
+			}
+			switch data[6] {
+			case 0: // string, held by the following STRING record
+				if w.addCell(sheet, data, xlsCell{kind: 's'}) {
+					formulaString = len(sheet.cells) - 1
+				}
+			case 1:
+				w.addCell(sheet, data, xlsCell{number: float64(data[8]), kind: 'b'})
+			}
+		case xlsRecordString:
+			if formulaString >= 0 && len(data) >= 3 {
+				sheet.cells[formulaString].text, _ = decodeXLSString(data, 2, int(binary.LittleEndian.Uint16(data)))
+				formulaString = -1
+			}
+		case xlsRecordMergeCells:
+			if len(data) < 2 {
+				continue
+			}
+			count := int(binary.LittleEndian.Uint16(data))
+			for i := 0; i < count && 2+i*8+8 <= len(data); i++ {
+				ref := data[2+i*8:]
+				sheet.merges = append(sheet.merges, importedArea{
+					firstRow: int(binary.LittleEndian.Uint16(ref)),
+					lastRow:  int(binary.LittleEndian.Uint16(ref[2:])),
+					firstCol: int(binary.LittleEndian.Uint16(ref[4:])),
+					lastCol:  int(binary.LittleEndian.Uint16(ref[6:])),
+				})
+			}
+		case xlsRecordMsoDrawing:
+			// the anchor of the next object is in the drawing record before it
+			if found, ok := findXLSAnchor(data); ok {
+				anchor = &found
+			}
+		case xlsRecordObj:
+			checkBox = nil
+			if checked, ok := parseXLSCheckBox(data); ok && anchor != nil {
+				sheet.checkBoxes = append(sheet.checkBoxes, importedCheckBox{row: anchor.firstRow, col: anchor.firstCol, checked: checked})
+				checkBox = &sheet.checkBoxes[len(sheet.checkBoxes)-1]
+			}
+			anchor = nil
+		case xlsRecordTxo:
+			// the label of a checkbox follows in the first CONTINUE record
+			if checkBox == nil || len(data) < 12 {
+				checkBox = nil
+				continue
+			}
+			cch := int(binary.LittleEndian.Uint16(data[10:]))
+			if id, text, next, ok := xlsRecordAt(stream, pos); ok && id == xlsRecordContinue && len(text) > 0 {
+				checkBox.text, _ = decodeXLSString(text, 0, cch)
+				pos = next
+			}
+			checkBox = nil
+		}
+	}
+}
+
+// cellArea returns the area from A1 to the last row and column holding a cell
+func (s *xlsSheet) cellArea() importedArea {
+	area := importedArea{lastRow: -1, lastCol: -1}
+	for _, cell := range s.cells {
+		area.lastRow, area.lastCol = max(area.lastRow, cell.row), max(area.lastCol, cell.col)
+	}
+	return area
+}
+
+// addCell adds a cell whose record starts with row, column and XF index
+func (w *xlsWorkbook) addCell(sheet *xlsSheet, data []byte, cell xlsCell) bool {
+	cell.row = int(binary.LittleEndian.Uint16(data))
+	cell.col = int(binary.LittleEndian.Uint16(data[2:]))
+	cell.xf = binary.LittleEndian.Uint16(data[4:])
+	return w.appendCell(sheet, cell)
+}
+
+// appendCell adds a cell to sheet unless it is past the rows or cells
+// limit, which is kept in limitErr
+func (w *xlsWorkbook) appendCell(sheet *xlsSheet, cell xlsCell) bool {
+	if w.limitErr != nil {
+		return false
+	}
+	w.cellCount++
+	if w.limitErr = w.limits.checkRows(sheet.name, cell.row+1); w.limitErr == nil {
+		w.limitErr = checkLimit(LimitCells, int64(w.cellCount), int64(w.limits.MaxCells))
+	}
+	if w.limitErr != nil {
+		return false
+	}
+	sheet.cells = append(sheet.cells, cell)
+	return true
+}
+
+// findXLSAnchor walks the OfficeArt records of a drawing record for the
+// client anchor of a shape
+func findXLSAnchor(data []byte) (importedArea, bool) {
+	for pos := 0; pos+8 <= len(data); {
+		version := binary.LittleEndian.Uint16(data[pos:]) & 0x000F
+		recordType := binary.LittleEndian.Uint16(data[pos+2:])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+
+		if recordType == xlsClientAnchorShape && pos+8+18 <= len(data) {
+			anchor := data[pos+8:]
+			return importedArea{
+				firstCol: int(binary.LittleEndian.Uint16(anchor[2:])),
+				firstRow: int(binary.LittleEndian.Uint16(anchor[6:])),
+				lastCol:  int(binary.LittleEndian.Uint16(anchor[10:])),
+				lastRow:  int(binary.LittleEndian.Uint16(anchor[14:])),
+			}, true
+		}
+
+		// step into containers, over atoms
+		if version == 0x000F {
+			pos += 8
+		} else {
+			pos += 8 + length
+		}
+	}
+	return importedArea{}, false
+}
+
+// parseXLSCheckBox reads the state of a checkbox from the sub records of an
+// OBJ record. The boolean is false for any other kind of object.
+func parseXLSCheckBox(data []byte) (bool, bool) {
+	isCheckBox, checked := false, false
+	for pos := 0; pos+4 <= len(data); {
+		ft := binary.LittleEndian.Uint16(data[pos:])
+		cb := int(binary.LittleEndian.Uint16(data[pos+2:]))
+		body := data[pos+4:]
+		if cb > len(body) {
+			break
+		}
+
+		switch ft {
+		case 0x0000: // FtEnd
+			return checked, isCheckBox
+		case 0x0015: // FtCmo
+			isCheckBox = cb >= 2 && binary.LittleEndian.Uint16(body) == xlsObjectCheckBox
+		case 0x0012: // FtCblsData
+			checked = cb >= 2 && binary.LittleEndian.Uint16(body) == 1
+		}
+		pos += 4 + cb
+	}
+	return checked, isCheckBox
+}
+
+// decodeXLSString decodes cch characters of an unformatted string whose
+// option flags are at data[pos]
+func decodeXLSString(data []byte, pos int, cch int) (string, int) {
+	if pos >= len(data) {
+		return "", pos
+	}
+	highByte := data[pos]&0x01 != 0
+	pos++
+
+	if !highByte {
+		end := min(pos+cch, len(data))
+		runes := make([]rune, 0, end-pos)
+		for _, b := range data[pos:end] {
+			runes = append(runes, rune(b))
+		}
+		return string(runes), end
+	}
+
+	end := min(pos+2*cch, len(data)&^1)
+	units := make([]uint16, 0, cch)
+	for i := pos; i+2 <= end; i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units)), end
+}
+
+// xlsSegments reads a record split into CONTINUE records. A string running
+// over a record boundary restarts with a new option flags byte.
+type xlsSegments struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (r *xlsSegments) byte() (byte, bool) {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	if r.seg >= len(r.segments) {
+		return 0, false
+	}
+	b := r.segments[r.seg][r.pos]
+	r.pos++
+	return b, true
+}
+
+func (r *xlsSegments) uint(size int) (uint32, bool) {
+	var value uint32
+	for i := 0; i < size; i++ {
+		b, ok := r.byte()
+		if !ok {
+			return 0, false
+		}
+		value |= uint32(b) << (8 * i)
+	}
+	return value, true
+}
+
+func (r *xlsSegments) skip(n int) {
+	for i := 0; i < n; i++ {
+		if _, ok := r.byte(); !ok {
+			return
+		}
+	}
+}
+
+func (r *xlsSegments) chars(cch int, highByte bool) (string, bool) {
+	units := make([]uint16, 0, cch)
+	for i := 0; i < cch; i++ {
+		if r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) && r.seg+1 < len(r.segments) {
+			r.seg++
+			r.pos = 0
+			flags, ok := r.byte()
+			if !ok {
+				return "", false
+			}
+			highByte = flags&0x01 != 0
+		}
+
+		size := 1
+		if highByte {
+			size = 2
+		}
+		unit, ok := r.uint(size)
+		if !ok {
+			return "", false
+		}
+		units = append(units, uint16(unit))
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// parseXLSSST reads the shared string table
+func parseXLSSST(segments [][]byte) []string {
+	r := &xlsSegments{segments: segments}
+	r.skip(4) // total count
+	unique, ok := r.uint(4)
+	if !ok {
+		return nil
+	}
+
+	// every string takes at least three bytes, a larger count is corrupt
+	size := 0
+	for _, segment := range segments {
+		size += len(segment)
+	}
+	strings := make([]string, 0, min(int(unique), size/3))
+	for i := uint32(0); i < unique; i++ {
+		cch, ok := r.uint(2)
+		if !ok {
+			break
+		}
+		flags, ok := r.byte()
+		if !ok {
+			break
+		}
+
+		runs, extSize := uint32(0), uint32(0)
+		if flags&0x08 != 0 {
+			runs, _ = r.uint(2)
+		}
+		if flags&0x04 != 0 {
+			extSize, _ = r.uint(4)
+		}
+		text, ok := r.chars(int(cch), flags&0x01 != 0)
+		if !ok {
+			break
+		}
+		r.skip(int(runs)*4 + int(extSize))
+		strings = append(strings, text)
+	}
+	return strings
+}
+
+// decodeRK decodes the compressed number of RK and MULRK records
+func decodeRK(rk uint32) float64 {
+	var value float64
+	if rk&0x02 != 0 {
+		value = float64(int32(rk) >> 2)
+	} else {
+		value = math.Float64frombits(uint64(rk&0xFFFFFFFC) << 32)
+	}
+	if rk&0x01 != 0 {
+		value /= 100
+	}
+	return value
+}
+
+// toExcelize imports the parsed workbook
+func (w *xlsWorkbook) toExcelize() (*excelize.File, error) {
+	sheetNames := make([]string, len(w.sheets))
+	for i, sheet := range w.sheets {
+		sheetNames[i] = sheet.name
+	}
+	f, err := newImportedFile(sheetNames)
+	if err != nil {
+		return nil, err
+	}
+	if w.date1904 {
+		date1904 := true
+		if err := f.SetWorkbookProps(&excelize.WorkbookPropsOptions{Date1904: &date1904}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	styles := map[uint16]int{}
+	for _, sheet := range w.sheets {
+		for _, cell := range sheet.cells {
+			name, err := excelize.CoordinatesToCellName(cell.col+1, cell.row+1)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			switch cell.kind {
+			case 's':
+				err = f.SetCellStr(sheet.name, name, cell.text)
+			case 'b':
+				err = f.SetCellBool(sheet.name, name, cell.number != 0)
+			default:
+				if err = f.SetCellFloat(sheet.name, name, cell.number, -1, 64); err == nil {
+					err = w.applyNumberFormat(f, styles, sheet.name, name, cell.xf)
+				}
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+
+		if err := addImportedShapes(f, sheet.name, sheet.cellArea(), sheet.merges, sheet.checkBoxes); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return reopenImportedFile(f)
+}
+
+// applyNumberFormat gives a number cell the number format of its XF, so it
+// reads as Excel displays it
+func (w *xlsWorkbook) applyNumberFormat(f *excelize.File, styles map[uint16]int, sheetName string, cell string, xf uint16) error {
+	if int(xf) >= len(w.xfFormats) || w.xfFormats[xf] == 0 {
+		return nil
+	}
+
+	style, ok := styles[xf]
+	if !ok {
+		format := w.xfFormats[xf]
+		numberStyle := &excelize.Style{NumFmt: int(format)}
+		if custom, ok := w.formats[format]; ok {
+			numberStyle = &excelize.Style{CustomNumFmt: &custom}
+		}
+
+		var err error
+		if style, err = f.NewStyle(numberStyle); err != nil {
+			return fmt.Errorf("number format %s: %w", strconv.Itoa(int(format)), err)
+		}
+		styles[xf] = style
+	}
+	return f.SetCellStyle(sheetName, cell, cell, style)
+}
@@ -0,0 +1,326 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func le16(v int) []byte { return binary.LittleEndian.AppendUint16(nil, uint16(v)) }
+func le32(v int) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(v)) }
+
+// xlsRecord encodes one BIFF8 record
+func xlsRecord(id uint16, parts ...[]byte) []byte {
+	data := bytes.Join(parts, nil)
+	return append(append(le16(int(id)), le16(len(data))...), data...)
+}
+
+// xlsString8 encodes an unformatted string of one byte characters
+func xlsString8(s string) []byte {
+	return append(append(le16(len(s)), 0), s...)
+}
+
+// xlsCellHeader encodes the row, column and XF index starting a cell record
+func xlsCellHeader(cell string, xf int) []byte {
+	col, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		panic(err)
+	}
+	return bytes.Join([][]byte{le16(row - 1), le16(col - 1), le16(xf)}, nil)
+}
+
+// xlsCheckBoxRecords encodes a checkbox anchored at the 0-based row and
+// column: its drawing, its OBJ record and the TXO record holding its label
+func xlsCheckBoxRecords(id int, row int, col int, checked bool, label string) []byte {
+	anchor := bytes.Join([][]byte{le16(0), le16(col), le16(0), le16(row), le16(0), le16(col), le16(0), le16(row), le16(0)}, nil)
+	anchorRecord := bytes.Join([][]byte{le16(0), le16(xlsClientAnchorShape), le32(len(anchor)), anchor}, nil)
+	container := bytes.Join([][]byte{le16(0x000F), le16(0xF004), le32(len(anchorRecord)), anchorRecord}, nil)
+
+	state := 0
+	if checked {
+		state = 1
+	}
+	obj := bytes.Join([][]byte{
+		le16(0x15), le16(18), le16(xlsObjectCheckBox), le16(id), make([]byte, 14), // FtCmo
+		le16(0x12), le16(8), le16(state), make([]byte, 6), // FtCblsData
+		le16(0), le16(0), // FtEnd
+	}, nil)
+	txo := bytes.Join([][]byte{make([]byte, 10), le16(len(label)), make([]byte, 6)}, nil)
+
+	return bytes.Join([][]byte{
+		xlsRecord(xlsRecordMsoDrawing, container),
+		xlsRecord(xlsRecordObj, obj),
+		xlsRecord(xlsRecordTxo, txo),
+		xlsRecord(xlsRecordContinue, []byte{0}, []byte(label)),
+	}, nil)
+}
+
+// xlsStream returns a BIFF8 Workbook stream with the globals records and one
+// worksheet named "Sheet" holding the sheet records
+func xlsStream(globals []byte, sheet []byte) []byte {
+	bof := xlsRecord(xlsRecordBOF, le16(xlsVersionBIFF8), le16(0x0005), make([]byte, 12))
+	eof := xlsRecord(xlsRecordEOF)
+	boundSheet := func(offset int) []byte {
+		return xlsRecord(xlsRecordBoundSheet, le32(offset), []byte{0, 0, 5, 0}, []byte("Sheet"))
+	}
+
+	offset := len(bof) + len(globals) + len(boundSheet(0)) + len(eof)
+	return bytes.Join([][]byte{
+		bof, globals, boundSheet(offset), eof,
+		xlsRecord(xlsRecordBOF, le16(xlsVersionBIFF8), le16(0x0010), make([]byte, 12)),
+		sheet,
+		eof,
+	}, nil)
+}
+
+// xlsTestStream returns a Workbook stream with a shared string running over
+// a CONTINUE record, cells of every kind, a merged range and two checkboxes
+func xlsTestStream() []byte {
+	// the last shared string switches to two byte characters in its CONTINUE
+	sst := xlsRecord(xlsRecordSST,
+		le32(3), le32(3),
+		xlsString8("Part Number"),
+		xlsString8("PN-1"),
+		le16(len([]rune("Country: Café ☒"))), []byte{0}, []byte("Country: "),
+	)
+	continued := []byte{1}
+	for _, unit := range utf16.Encode([]rune("Café ☒")) {
+		continued = append(continued, le16(int(unit))...)
+	}
+
+	var xfs []byte
+	for i := 0; i < 16; i++ {
+		xfs = append(xfs, xlsRecord(xlsRecordXF, le16(0), le16(0), make([]byte, 16))...)
+	}
+	// XF 16 shows a date
+	xfs = append(xfs, xlsRecord(xlsRecordXF, le16(0), le16(164), make([]byte, 16))...)
+
+	globals := bytes.Join([][]byte{
+		xlsRecord(xlsRecordFormat, le16(164), xlsString8("dd/mm/yyyy")),
+		xfs,
+		sst,
+		xlsRecord(xlsRecordContinue, continued),
+	}, nil)
+
+	number := binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5))
+	date := binary.LittleEndian.AppendUint64(nil, math.Float64bits(45292))
+	sheet := bytes.Join([][]byte{
+		xlsRecord(xlsRecordLabelSST, xlsCellHeader("B12", 0), le32(0)),
+		xlsRecord(xlsRecordLabelSST, xlsCellHeader("E12", 0), le32(1)),
+		xlsRecord(xlsRecordLabelSST, xlsCellHeader("E13", 0), le32(2)),
+		xlsRecord(xlsRecordLabel, xlsCellHeader("B13", 0), xlsString8("Description")),
+		xlsRecord(xlsRecordRK, xlsCellHeader("E14", 0), le32(5<<2|2)),
+		xlsRecord(xlsRecordMulRK, xlsCellHeader("E15", 0), le32(41<<2|2), le16(0), le32(42<<2|2), le16(5)),
+		xlsRecord(xlsRecordNumber, xlsCellHeader("E16", 0), number),
+		xlsRecord(xlsRecordNumber, xlsCellHeader("E17", 16), date),
+		xlsRecord(xlsRecordBoolErr, xlsCellHeader("E18", 0), []byte{1, 0}),
+		// formula with a string result held by the STRING record after it
+		xlsRecord(xlsRecordFormula, xlsCellHeader("E19", 0), []byte{0, 0, 0, 0, 0, 0, 0xFF, 0xFF}, le16(0), le32(0), le16(0)),
+		xlsRecord(xlsRecordString, xlsString8("SPN-F")),
+		xlsRecord(xlsRecordMergeCells, le16(1), le16(12), le16(12), le16(4), le16(5)),
+		xlsCheckBoxRecords(1, 20, 6, true, "YES"),
+		xlsCheckBoxRecords(2, 21, 6, false, "NO"),
+	}, nil)
+	return xlsStream(globals, sheet)
+}
+
+func TestOpenXLS(t *testing.T) {
+	f, err := openXLS(xlsTestStream(), DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got := f.GetSheetList(); len(got) != 1 || got[0] != "Sheet" {
+		t.Fatalf("got sheets %q, want [Sheet]", got)
+	}
+
+	cells := map[string]string{
+		"B12": "Part Number",
+		"E12": "PN-1",
+		"E13": "Country: Café ☒",
+		"B13": "Description",
+		"E14": "5",
+		"E15": "41",
+		"F15": "42",
+		"E16": "1.5",
+		"E17": "01/01/2024",
+		"E18": "TRUE",
+		"E19": "SPN-F",
+	}
+	for cell, want := range cells {
+		got, err := f.GetCellValue("Sheet", cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", cell, got, want)
+		}
+	}
+
+	merges, err := f.GetMergeCells("Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merges) != 1 || merges[0].GetStartAxis() != "E13" || merges[0].GetEndAxis() != "F13" {
+		t.Errorf("got merged ranges %v, want E13:F13", merges)
+	}
+
+	controls, err := (&excelizeWorkbook{file: f}).FormControls("Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		cell    string
+		text    string
+		checked bool
+	}{{"G21", "YES", true}, {"G22", "NO", false}}
+	if len(controls) != len(want) {
+		t.Fatalf("got %d form controls, want %d", len(controls), len(want))
+	}
+	for i, control := range controls {
+		if control.Type != FormControlCheckBox || control.Cell != want[i].cell || controlText(control) != want[i].text || control.Checked != want[i].checked {
+			t.Errorf("got checkbox %s %q checked %v, want %s %q checked %v", control.Cell, controlText(control), control.Checked, want[i].cell, want[i].text, want[i].checked)
+		}
+	}
+}
+
+func TestOpenXLSClipsMergedRange(t *testing.T) {
+	// a merge over the whole sheet would make excelize fill every cell of it
+	sheet := bytes.Join([][]byte{
+		xlsRecord(xlsRecordLabel, xlsCellHeader("B2", 0), xlsString8("Buyer")),
+		xlsRecord(xlsRecordMergeCells, le16(1), le16(0), le16(65535), le16(0), le16(255)),
+	}, nil)
+	f, err := openXLS(xlsStream(nil, sheet), DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	merges, err := f.GetMergeCells("Sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merges) != 1 || merges[0].GetStartAxis() != "A1" || merges[0].GetEndAxis() != "B2" {
+		t.Errorf("got merged ranges %v, want A1:B2", merges)
+	}
+}
+
+func TestOpenXLSErrors(t *testing.T) {
+	valid := xlsTestStream()
+	// a sheet record whose length runs past the end of the stream
+	oversized := xlsStream(nil, append(le16(xlsRecordLabel), le16(0x2000)...))
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		wantErr string
+	}{
+		{
+			name:    "empty stream",
+			wantErr: "only BIFF8",
+		},
+		{
+			name:    "BIFF5 workbook",
+			stream:  xlsRecord(xlsRecordBOF, le16(0x0500), le16(0x0005)),
+			wantErr: "only BIFF8",
+		},
+		{
+			name:    "globals cut short",
+			stream:  valid[:200],
+			wantErr: "truncated .xls workbook globals",
+		},
+		{
+			name:    "record header cut short",
+			stream:  valid[:len(valid)-2],
+			wantErr: "truncated worksheet",
+		},
+		{
+			name:    "record longer than the stream",
+			stream:  oversized,
+			wantErr: "truncated worksheet",
+		},
+		{
+			name:    "encrypted workbook",
+			stream:  xlsStream(xlsRecord(xlsRecordFilePass, make([]byte, 6)), nil),
+			wantErr: "encrypted",
+		},
+		{
+			name:    "no worksheet",
+			stream:  bytes.Join([][]byte{xlsRecord(xlsRecordBOF, le16(xlsVersionBIFF8), le16(0x0005)), xlsRecord(xlsRecordEOF)}, nil),
+			wantErr: "no worksheets",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := openXLS(test.stream, DefaultLimits())
+			if err == nil {
+				f.Close()
+				t.Fatalf("got no error, want %q", test.wantErr)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %q, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenXLSLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string // limit exceeded, empty when the workbook opens
+	}{
+		{name: "within the default limits", limits: DefaultLimits()},
+		{name: "no limits", limits: Limits{}},
+		{name: "rows", limits: Limits{MaxRows: 12}, want: LimitRows},
+		{name: "cells", limits: Limits{MaxCells: 5}, want: LimitCells},
+		{name: "cells within the limit", limits: Limits{MaxCells: 20}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := openXLS(xlsTestStream(), test.limits)
+			if err == nil {
+				f.Close()
+			}
+			var limitErr LimitExceededError
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case test.want != "" && (!errors.As(err, &limitErr) || limitErr.Limit != test.want):
+				t.Errorf("got %v, want the %s limit", err, test.want)
+			}
+		})
+	}
+}
+
+func FuzzOpenXLS(f *testing.F) {
+	valid := xlsTestStream()
+	f.Add(valid)
+	f.Add(valid[:len(valid)/2])
+	f.Add(xlsStream(nil, xlsRecord(xlsRecordMergeCells, le16(100))))
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		for pos := 0; ; {
+			_, data, next, ok := xlsRecordAt(stream, pos)
+			if !ok {
+				break
+			}
+			if next > len(stream) || next != pos+4+len(data) {
+				t.Fatalf("record at %d ends at %d in a stream of %d bytes", pos, next, len(stream))
+			}
+			pos = next
+		}
+
+		// Any input is either converted or rejected, never a panic
+		if f, err := openXLS(stream, DefaultLimits()); err == nil {
+			f.Close()
+		}
+	})
+}